@@ -2,16 +2,33 @@ package api
 
 import (
 	"net/http"
+
+	"github.com/gorilla/mux"
 )
 
-// getCircuitBreakerStatusHandler returns the current state of the circuit breaker
+// getCircuitBreakerStatusHandler returns the current state of all circuit breakers
 func (s *Server) getCircuitBreakerStatusHandler(w http.ResponseWriter, r *http.Request) {
-	metrics := s.gracefulDegradation.GetMetrics()
+	metrics := s.breakerRegistry.GetMetrics()
 
 	s.respondWithJSON(w, http.StatusOK, ApiResponse{Success: true, Data: metrics})
 }
 
-// resetCircuitBreakerHandler resets the circuit breaker to closed state
+// getNamedCircuitBreakerHandler returns the current state of a single circuit breaker
+func (s *Server) getNamedCircuitBreakerHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	name := vars["name"]
+
+	breaker, exists := s.breakerRegistry.Get(name)
+
+	if !exists {
+		s.respondWithError(w, http.StatusNotFound, "Circuit breaker not found")
+		return
+	}
+
+	s.respondWithJSON(w, http.StatusOK, ApiResponse{Success: true, Data: breaker.GetMetrics()})
+}
+
+// resetCircuitBreakerHandler resets the inbound HTTP circuit breaker to closed state
 func (s *Server) resetCircuitBreakerHandler(w http.ResponseWriter, r *http.Request) {
 	s.gracefulDegradation.Reset()
 
@@ -21,4 +38,52 @@ func (s *Server) resetCircuitBreakerHandler(w http.ResponseWriter, r *http.Reque
 			"message": "Circuit breaker reset successfully",
 		},
 	})
-}
\ No newline at end of file
+}
+
+// resetNamedCircuitBreakerHandler resets a single circuit breaker by name
+func (s *Server) resetNamedCircuitBreakerHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	name := vars["name"]
+
+	breaker, exists := s.breakerRegistry.Get(name)
+
+	if !exists {
+		s.respondWithError(w, http.StatusNotFound, "Circuit breaker not found")
+		return
+	}
+
+	breaker.Reset()
+	s.logger.Info("Circuit breaker reset via admin API", "breaker", name)
+
+	s.respondWithJSON(w, http.StatusOK, ApiResponse{
+		Success: true,
+		Data: map[string]string{
+			"message": "Circuit breaker reset successfully",
+			"name":    name,
+		},
+	})
+}
+
+// forceOpenCircuitBreakerHandler opens a circuit breaker until it is reset
+func (s *Server) forceOpenCircuitBreakerHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	name := vars["name"]
+
+	breaker, exists := s.breakerRegistry.Get(name)
+
+	if !exists {
+		s.respondWithError(w, http.StatusNotFound, "Circuit breaker not found")
+		return
+	}
+
+	breaker.ForceOpen()
+	s.logger.Warn("Circuit breaker forced open via admin API", "breaker", name)
+
+	s.respondWithJSON(w, http.StatusOK, ApiResponse{
+		Success: true,
+		Data: map[string]string{
+			"message": "Circuit breaker opened successfully",
+			"name":    name,
+		},
+	})
+}
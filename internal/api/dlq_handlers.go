@@ -3,38 +3,45 @@ package api
 import (
 	"encoding/json"
 	"net/http"
+	"net/url"
 	"errors"
 	"strconv"
 
 	"github.com/gorilla/mux"
+	"github.com/vaidashi/fault-tolerant-api/internal/outbox"
 	"github.com/vaidashi/fault-tolerant-api/internal/repository"
 	"github.com/vaidashi/fault-tolerant-api/internal/models"
 )
 
-// getDeadLettersHandler returns a list of dead letter messages
+// getDeadLettersHandler returns a filtered list of dead letter messages using keyset pagination
 func (s *Server) getDeadLettersHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
+	query := r.URL.Query()
 
-	// Parse pagination parameters
-	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	pageSize, err := strconv.Atoi(query.Get("pageSize"))
 
-	if err != nil || page < 1 {
-		page = 1
+	if err != nil || pageSize < 1 || pageSize > 100 {
+		pageSize = 10
 	}
 
-	pageSize, err := strconv.Atoi(r.URL.Query().Get("pageSize"))
+	filter, err := parseDeadLetterFilter(query)
 
-	if err != nil || pageSize < 1 || pageSize > 100 {
-		pageSize = 10
+	if err != nil {
+		s.respondWithError(w, http.StatusBadRequest, err.Error())
+		return
 	}
 
-	// Calculate offset
-	offset := (page - 1) * pageSize
+	// Continue after the last message of the previous page
+	var cursor *repository.Cursor
 
-	status := r.URL.Query().Get("status")
+	if value := query.Get("cursor"); value != "" {
+		if cursor, err = repository.DecodeCursor(value); err != nil {
+			s.respondWithError(w, http.StatusBadRequest, "Invalid cursor")
+			return
+		}
+	}
 
-	// Just get pending messages for simplicity
-	messages, err := s.dlqRepo.GetPendingMessages(ctx, pageSize)
+	messages, next, err := s.dlqRepo.List(ctx, filter, cursor, pageSize)
 
 	if err != nil {
 		s.logger.Error("Failed to fetch dead letter messages", "error", err)
@@ -42,18 +49,48 @@ func (s *Server) getDeadLettersHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	totalCount, err := s.dlqRepo.Count(ctx, filter)
+
+	if err != nil {
+		s.logger.Error("Failed to count dead letter messages", "error", err)
+	}
+
 	response := PaginationResponse{
 		Items: messages,
-		TotalCount: len(messages),
-		Page: page,
+		TotalCount: totalCount,
 		PageSize: pageSize,
-		Offset: offset,
-		Status: status,
+		Status: filter.Status,
+	}
+
+	if next != nil {
+		response.NextCursor = next.Encode()
 	}
 
 	s.respondWithJSON(w, http.StatusOK, ApiResponse{Success: true, Data: response})
 }
 
+// parseDeadLetterFilter builds a dead letter filter from query parameters
+func parseDeadLetterFilter(query url.Values) (*repository.DeadLetterFilter, error) {
+	filter := &repository.DeadLetterFilter{
+		Status:        query.Get("status"),
+		EventType:     query.Get("event_type"),
+		FailureReason: query.Get("failure_reason"),
+		AggregateID:   query.Get("aggregate_id"),
+	}
+
+	var err error
+
+	if filter.CreatedAfter, err = parseTimeParam(query.Get("from")); err != nil {
+		return nil, errors.New("Invalid from time, expected RFC3339")
+	}
+
+	if filter.CreatedBefore, err = parseTimeParam(query.Get("to")); err != nil {
+		return nil, errors.New("Invalid to time, expected RFC3339")
+	}
+
+	return filter, nil
+}
+
 // retryDeadLetterHandler attempts to retry a dead letter message
 func (s *Server) retryDeadLetterHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
@@ -86,7 +123,7 @@ func (s *Server) retryDeadLetterHandler(w http.ResponseWriter, r *http.Request)
 	}
 
 	// Mark as retrying
-	if err := s.dlqRepo.MarkAsRetrying(ctx, id); err != nil {
+	if err := s.dlqRepo.MarkAsRetrying(ctx, id, models.DeadLetterActorAdminAPI); err != nil {
 		s.logger.Error("Failed to mark message as retrying", "error", err, "messageID", id)
 		s.respondWithError(w, http.StatusInternalServerError, "Failed to mark message for retry")
 		return
@@ -132,7 +169,7 @@ func (s *Server) discardDeadLetterHandler(w http.ResponseWriter, r *http.Request
 	}
 
 		// Mark as discarded
-	if err := s.dlqRepo.MarkAsDiscarded(ctx, id, req.Reason); err != nil {
+	if err := s.dlqRepo.MarkAsDiscarded(ctx, id, req.Reason, models.DeadLetterActorAdminAPI); err != nil {
 		if errors.Is(err, repository.ErrNotFound) {
 			s.respondWithError(w, http.StatusNotFound, "Dead letter message not found")
 			return
@@ -149,4 +186,256 @@ func (s *Server) discardDeadLetterHandler(w http.ResponseWriter, r *http.Request
 			"id":      idStr,
 		},
 	})
-}
\ No newline at end of file
+}
+// bulkDeadLetterRequest selects the pending dead letters a bulk job applies to
+type bulkDeadLetterRequest struct {
+	EventType     string `json:"event_type"`
+	FailureReason string `json:"failure_reason"`
+	AggregateID   string `json:"aggregate_id"`
+	From          string `json:"from"`
+	To            string `json:"to"`
+	DryRun        bool   `json:"dry_run"`
+	Reason        string `json:"reason"`
+}
+
+// bulkRetryDeadLettersHandler starts a background job retrying matching dead letters
+func (s *Server) bulkRetryDeadLettersHandler(w http.ResponseWriter, r *http.Request) {
+	s.startDeadLetterJob(w, r, outbox.DeadLetterJobRetry)
+}
+
+// bulkDiscardDeadLettersHandler starts a background job discarding matching dead letters
+func (s *Server) bulkDiscardDeadLettersHandler(w http.ResponseWriter, r *http.Request) {
+	s.startDeadLetterJob(w, r, outbox.DeadLetterJobDiscard)
+}
+
+// startDeadLetterJob parses a bulk request and starts the job
+func (s *Server) startDeadLetterJob(w http.ResponseWriter, r *http.Request, action outbox.DeadLetterJobAction) {
+	var req bulkDeadLetterRequest
+
+	decoder := json.NewDecoder(r.Body)
+
+	if err := decoder.Decode(&req); err != nil {
+		s.respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	filter, err := parseDeadLetterFilter(url.Values{
+		"event_type":     {req.EventType},
+		"failure_reason": {req.FailureReason},
+		"aggregate_id":   {req.AggregateID},
+		"from":           {req.From},
+		"to":             {req.To},
+	})
+
+	if err != nil {
+		s.respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Refuse to touch the whole queue by accident
+	if filter.EventType == "" && filter.FailureReason == "" && filter.AggregateID == "" &&
+		filter.CreatedAfter == nil && filter.CreatedBefore == nil {
+		s.respondWithError(w, http.StatusBadRequest, "At least one filter is required")
+		return
+	}
+
+	if action == outbox.DeadLetterJobDiscard && req.Reason == "" {
+		req.Reason = "Bulk discard"
+	}
+
+	job, err := s.deadLetterJobs.StartJob(action, *filter, req.Reason, req.DryRun)
+
+	if err != nil {
+		s.logger.Error("Failed to start dead letter job", "error", err, "action", action)
+		s.respondWithError(w, http.StatusInternalServerError, "Failed to start dead letter job")
+		return
+	}
+
+	s.respondWithJSON(w, http.StatusAccepted, ApiResponse{Success: true, Data: job})
+}
+
+// getDeadLetterJobsHandler lists bulk dead letter jobs
+func (s *Server) getDeadLetterJobsHandler(w http.ResponseWriter, r *http.Request) {
+	s.respondWithJSON(w, http.StatusOK, ApiResponse{Success: true, Data: s.deadLetterJobs.ListJobs()})
+}
+
+// getDeadLetterJobHandler returns the progress of a bulk dead letter job
+func (s *Server) getDeadLetterJobHandler(w http.ResponseWriter, r *http.Request) {
+	job, err := s.deadLetterJobs.GetJob(mux.Vars(r)["id"])
+
+	if err != nil {
+		s.respondWithError(w, http.StatusNotFound, "Dead letter job not found")
+		return
+	}
+
+	s.respondWithJSON(w, http.StatusOK, ApiResponse{Success: true, Data: job})
+}
+
+// cancelDeadLetterJobHandler cancels a running bulk dead letter job
+func (s *Server) cancelDeadLetterJobHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	if err := s.deadLetterJobs.CancelJob(id); err != nil {
+		s.respondWithError(w, http.StatusNotFound, "Dead letter job not found")
+		return
+	}
+
+	s.respondWithJSON(w, http.StatusOK, ApiResponse{
+		Success: true,
+		Data: map[string]string{
+			"message": "Dead letter job cancellation requested",
+			"id":      id,
+		},
+	})
+}
+
+// editDeadLetterPayloadHandler corrects the payload of a pending dead letter and optionally redrives it
+func (s *Server) editDeadLetterPayloadHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	idStr := vars["id"]
+
+	id, err := strconv.ParseInt(idStr, 10, 64)
+
+	if err != nil {
+		s.respondWithError(w, http.StatusBadRequest, "Invalid message ID")
+		return
+	}
+
+	var req struct {
+		Payload json.RawMessage `json:"payload"`
+		Editor  string          `json:"editor"`
+		Redrive bool            `json:"redrive"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+
+	if err := decoder.Decode(&req); err != nil {
+		s.respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	if req.Editor == "" {
+		s.respondWithError(w, http.StatusBadRequest, "Editor is required")
+		return
+	}
+
+	if len(req.Payload) == 0 {
+		s.respondWithError(w, http.StatusBadRequest, "Payload is required")
+		return
+	}
+
+	message, err := s.dlqRepo.GetMessage(ctx, id)
+
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			s.respondWithError(w, http.StatusNotFound, "Dead letter message not found")
+			return
+		}
+		s.logger.Error("Failed to fetch dead letter message", "error", err, "messageID", id)
+		s.respondWithError(w, http.StatusInternalServerError, "Failed to fetch dead letter message")
+		return
+	}
+
+	if err := models.ValidateEventPayload(req.Payload, message.EventType, message.AggregateID); err != nil {
+		s.respondWithError(w, http.StatusUnprocessableEntity, "Invalid payload: "+err.Error())
+		return
+	}
+
+	edit, err := s.dlqRepo.UpdatePayload(ctx, id, req.Payload, req.Editor)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrNotFound):
+			s.respondWithError(w, http.StatusNotFound, "Dead letter message not found")
+		case errors.Is(err, repository.ErrNotPending):
+			s.respondWithError(w, http.StatusConflict, "Only pending messages can be edited")
+		default:
+			s.logger.Error("Failed to edit dead letter payload", "error", err, "messageID", id)
+			s.respondWithError(w, http.StatusInternalServerError, "Failed to edit dead letter payload")
+		}
+		return
+	}
+
+	s.logger.Info("Dead letter payload edited", "messageID", id, "editor", req.Editor, "editID", edit.ID)
+
+	response := map[string]interface{}{
+		"edit": edit,
+	}
+
+	if req.Redrive {
+		message.Payload = edit.EditedPayload
+
+		if err := s.deadLetterProcessor.Redrive(ctx, message, models.DeadLetterActorAdminAPI); err != nil {
+			s.logger.Error("Failed to redrive edited dead letter", "error", err, "messageID", id)
+			response["redriven"] = false
+			response["redrive_error"] = err.Error()
+
+			// The edit is saved, tell the client only the redrive has to be tried again
+			s.respondWithJSON(w, http.StatusBadGateway, ApiResponse{
+				Success: false,
+				Data:    response,
+				Error:   "Dead letter payload edited but redrive failed",
+			})
+			return
+		}
+
+		response["redriven"] = true
+	}
+
+	s.respondWithJSON(w, http.StatusOK, ApiResponse{Success: true, Data: response})
+}
+
+// getDeadLetterEditsHandler returns the payload edit history of a dead letter
+func (s *Server) getDeadLetterEditsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+
+	if err != nil {
+		s.respondWithError(w, http.StatusBadRequest, "Invalid message ID")
+		return
+	}
+
+	edits, err := s.dlqRepo.ListEdits(r.Context(), id)
+
+	if err != nil {
+		s.logger.Error("Failed to fetch dead letter edits", "error", err, "messageID", id)
+		s.respondWithError(w, http.StatusInternalServerError, "Failed to fetch dead letter edits")
+		return
+	}
+
+	s.respondWithJSON(w, http.StatusOK, ApiResponse{Success: true, Data: edits})
+}
+
+// getDeadLetterHistoryHandler returns the state transitions and retry attempts of a dead letter
+func (s *Server) getDeadLetterHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+
+	if err != nil {
+		s.respondWithError(w, http.StatusBadRequest, "Invalid message ID")
+		return
+	}
+
+	if _, err := s.dlqRepo.GetMessage(ctx, id); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			s.respondWithError(w, http.StatusNotFound, "Dead letter message not found")
+			return
+		}
+		s.logger.Error("Failed to fetch dead letter message", "error", err, "messageID", id)
+		s.respondWithError(w, http.StatusInternalServerError, "Failed to fetch dead letter message")
+		return
+	}
+
+	events, err := s.dlqRepo.ListEvents(ctx, id)
+
+	if err != nil {
+		s.logger.Error("Failed to fetch dead letter history", "error", err, "messageID", id)
+		s.respondWithError(w, http.StatusInternalServerError, "Failed to fetch dead letter history")
+		return
+	}
+
+	s.respondWithJSON(w, http.StatusOK, ApiResponse{Success: true, Data: events})
+}
@@ -2,14 +2,17 @@ package api
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"errors"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/vaidashi/fault-tolerant-api/internal/models"
 	"github.com/vaidashi/fault-tolerant-api/internal/repository"
+	"github.com/vaidashi/fault-tolerant-api/internal/service"
 )
 
 type ApiResponse struct {
@@ -22,18 +25,21 @@ type ApiResponse struct {
 type OrderRequest struct {
 	CustomerID string    `json:"customer_id"`
 	Amount  float64   `json:"amount"`
-	Status   string    `json:"status, omitempty"`
-	Description string `json:"description, omitempty"`
+	Status   string    `json:"status,omitempty"`
+	Description string `json:"description,omitempty"`
+	Items []models.OrderItem `json:"items,omitempty"`
+	ShippingAddress *models.ShippingAddress `json:"shipping_address,omitempty"`
 }
 
 // PaginationResponse is a wrapper for paginated results
 type PaginationResponse struct {
 	Items      interface{} `json:"items"`
 	TotalCount int         `json:"total_count"`
-	Page       int         `json:"page"`
+	Page       int         `json:"page,omitempty"`
 	PageSize   int         `json:"page_size"`
 	Offset     int         `json:"offset,omitempty"`
 	Status     string      `json:"status,omitempty"`
+	NextCursor string      `json:"next_cursor,omitempty"`
 }
 
 // Health represents the health check response
@@ -148,19 +154,25 @@ func (s *Server) createOrderHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	
-	if req.Amount <= 0 {
-		s.respondWithError(w, http.StatusBadRequest, "Amount must be greater than zero")
+	// The amount is computed from the items, a client sent one must agree with it
+	if req.Amount != 0 && req.Amount != models.OrderItemsTotal(req.Items) {
+		s.respondWithError(w, http.StatusBadRequest, "Amount does not match the total of the order items")
 		return
 	}
 	
-	order, err := s.orderService.CreateOrder(ctx, req.CustomerID, req.Amount, req.Description)
+	order, err := s.orderService.CreateOrder(ctx, req.CustomerID, req.Items, req.ShippingAddress, req.Description)
 
 	if err != nil {
+		if errors.Is(err, models.ErrInvalidOrder) {
+			s.respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
 		s.logger.Error("Failed to create order", "error", err)
 		s.respondWithError(w, http.StatusInternalServerError, "Failed to create order")
 		return
 	}
 	
+	w.Header().Set("ETag", orderETag(order))
 	s.respondWithJSON(w, http.StatusCreated, ApiResponse{Success: true, Data: order})
 }
 
@@ -182,6 +194,14 @@ func (s *Server) getOrderByIDHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	
+	etag := orderETag(order)
+	w.Header().Set("ETag", etag)
+
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
 	s.respondWithJSON(w, http.StatusOK, ApiResponse{Success: true, Data: order})
 }
 
@@ -201,18 +221,34 @@ func (s *Server) updateOrderHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	defer r.Body.Close()
 
-	order, err := s.orderService.UpdateOrder(ctx, id, req.CustomerID, req.Amount, req.Description)
+	expectedVersion, ok := ifMatchVersion(r)
+
+	if !ok {
+		s.respondWithError(w, http.StatusPreconditionFailed, "If-Match does not match the current order version")
+		return
+	}
+
+	order, err := s.orderService.UpdateOrder(ctx, id, req.CustomerID, req.Amount, req.Description, expectedVersion)
 
 	if err != nil {
 		if errors.Is(err, repository.ErrNotFound) {
 			s.respondWithError(w, http.StatusNotFound, "Order not found")
 			return
 		}
+		if errors.Is(err, repository.ErrVersionConflict) {
+			s.respondWithVersionConflict(w, expectedVersion)
+			return
+		}
+		if errors.Is(err, models.ErrInvalidOrder) {
+			s.respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
 		s.logger.Error("Failed to update order", "error", err, "orderID", id)
 		s.respondWithError(w, http.StatusInternalServerError, "Failed to update order")
 		return
 	}
 	
+	w.Header().Set("ETag", orderETag(order))
 	s.respondWithJSON(w, http.StatusOK, ApiResponse{Success: true, Data: order})
 }
 
@@ -240,50 +276,88 @@ func (s *Server) updateOrderStatusHandler(w http.ResponseWriter, r *http.Request
         return
     }
     
-    // Validate the status (in a real app, you'd have more rigorous validation)
-    validStatuses := map[string]bool{
-        string(models.OrderStatusPending):   true,
-        string(models.OrderStatusApproved):  true,
-        string(models.OrderStatusRejected):  true,
-        string(models.OrderStatusShipped):   true,
-        string(models.OrderStatusDelivered): true,
-        string(models.OrderStatusCancelled): true,
-    }
-    
-    if !validStatuses[statusRequest.Status] {
+    if !models.OrderStatus(statusRequest.Status).IsValid() {
         s.respondWithError(w, http.StatusBadRequest, "Invalid status value")
         return
     }
     
-    
-    order, err := s.orderService.UpdateOrderStatus(ctx, id, statusRequest.Status)
+    expectedVersion, ok := ifMatchVersion(r)
+
+    if !ok {
+        s.respondWithError(w, http.StatusPreconditionFailed, "If-Match does not match the current order version")
+        return
+    }
+
+    order, err := s.orderService.UpdateOrderStatus(ctx, id, statusRequest.Status, expectedVersion)
     
 	if err != nil {
         if errors.Is(err, repository.ErrNotFound) {
             s.respondWithError(w, http.StatusNotFound, "Order not found")
             return
         }
+        if errors.Is(err, repository.ErrVersionConflict) {
+            s.respondWithVersionConflict(w, expectedVersion)
+            return
+        }
+        if errors.Is(err, service.ErrIllegalTransition) {
+            s.respondWithError(w, http.StatusConflict, err.Error())
+            return
+        }
         s.logger.Error("Failed to update order status", "error", err, "orderID", id)
         s.respondWithError(w, http.StatusInternalServerError, "Failed to update order status")
         return
     }
     
+    w.Header().Set("ETag", orderETag(order))
     s.respondWithJSON(w, http.StatusOK, ApiResponse{Success: true, Data: order})
 }
 
+// OrderStatusInfo describes an order status and where it may move to
+type OrderStatusInfo struct {
+    Status      models.OrderStatus   `json:"status"`
+    Terminal    bool                 `json:"terminal"`
+    Transitions []models.OrderStatus `json:"transitions"`
+}
+
+// getOrderTransitionsHandler returns the order status transition table
+func (s *Server) getOrderTransitionsHandler(w http.ResponseWriter, r *http.Request) {
+    statuses := make([]OrderStatusInfo, 0, len(models.OrderStatuses))
+
+    for _, status := range models.OrderStatuses {
+        statuses = append(statuses, OrderStatusInfo{
+            Status:      status,
+            Terminal:    status.IsTerminal(),
+            Transitions: models.OrderTransitions[status],
+        })
+    }
+
+    s.respondWithJSON(w, http.StatusOK, ApiResponse{Success: true, Data: statuses})
+}
+
 // deleteOrderHandler deletes an order
 func (s *Server) deleteOrderHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	vars := mux.Vars(r)
 	id := vars["id"]
 	
-	err := s.orderService.DeleteOrder(ctx, id)
+	expectedVersion, ok := ifMatchVersion(r)
+
+	if !ok {
+		s.respondWithError(w, http.StatusPreconditionFailed, "If-Match does not match the current order version")
+		return
+	}
+
+	err := s.orderService.DeleteOrder(ctx, id, expectedVersion)
 
 	if err != nil {
 		if errors.Is(err, repository.ErrNotFound) {
 			s.respondWithError(w, http.StatusNotFound, "Order not found")
 			return
 		}
+		if errors.Is(err, repository.ErrVersionConflict) {
+			s.respondWithVersionConflict(w, expectedVersion)
+			return
+		}
 		s.logger.Error("Failed to delete order", "error", err, "orderID", id)
 		s.respondWithError(w, http.StatusInternalServerError, "Failed to delete order")
 		return
@@ -292,6 +366,45 @@ func (s *Server) deleteOrderHandler(w http.ResponseWriter, r *http.Request) {
 	s.respondWithJSON(w, http.StatusOK, ApiResponse{Success: true, Data: map[string]string{"message": "Order deleted successfully"}})
 }
 
+// orderETag returns the entity tag identifying the current version of an order
+func orderETag(order *models.Order) string {
+	return fmt.Sprintf("%q", strconv.Itoa(order.Version))
+}
+
+// ifMatchVersion returns the order version required by the If-Match header,
+// 0 when the header is absent or "*". ok is false for a tag that can never
+// match an order, such as a weak tag.
+func ifMatchVersion(r *http.Request) (version int, ok bool) {
+	ifMatch := strings.TrimSpace(r.Header.Get("If-Match"))
+
+	if ifMatch == "" || ifMatch == "*" {
+		return 0, true
+	}
+
+	if len(ifMatch) < 2 || ifMatch[0] != '"' || ifMatch[len(ifMatch)-1] != '"' {
+		return 0, false
+	}
+
+	version, err := strconv.Atoi(ifMatch[1 : len(ifMatch)-1])
+
+	if err != nil || version <= 0 {
+		return 0, false
+	}
+
+	return version, true
+}
+
+// respondWithVersionConflict reports an order that changed under the request,
+// 412 if the client's If-Match was stale, 409 if it changed while we handled it
+func (s *Server) respondWithVersionConflict(w http.ResponseWriter, expectedVersion int) {
+	if expectedVersion != 0 {
+		s.respondWithError(w, http.StatusPreconditionFailed, "Order was modified, fetch it again and retry")
+		return
+	}
+
+	s.respondWithError(w, http.StatusConflict, "Order was modified concurrently, retry the request")
+}
+
 // respondWithError sends a JSON response with an error message
 func (s *Server) respondWithError(w http.ResponseWriter, code int, message string) {
 	s.respondWithJSON(w, code, ApiResponse{
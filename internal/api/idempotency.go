@@ -0,0 +1,203 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/vaidashi/fault-tolerant-api/internal/models"
+	"github.com/vaidashi/fault-tolerant-api/internal/repository"
+)
+
+const (
+	// IdempotencyKeyHeader is the request header carrying the client's idempotency key
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// IdempotentReplayedHeader is set on responses replayed from a previous request
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+
+	maxIdempotencyKeyLength = 255
+	maxIdempotentBodySize   = 1 << 20
+
+	// idempotencyLockTimeout is how long a request may hold a key before a retry can take it over
+	idempotencyLockTimeout = 1 * time.Minute
+	// idempotencyKeyTTL is how long responses are kept for replay
+	idempotencyKeyTTL = 24 * time.Hour
+)
+
+// replayedHeaders are the response headers stored with an idempotent response and sent again on replay
+var replayedHeaders = []string{"ETag", "Location", "Retry-After"}
+
+// idempotencyRecorder captures the response written by a handler so it can be replayed
+type idempotencyRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *idempotencyRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *idempotencyRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+// requestFingerprint hashes the parts of a request that must match when a key is reused
+func requestFingerprint(body []byte) string {
+	hash := sha256.Sum256(body)
+	return hex.EncodeToString(hash[:])
+}
+
+// storedHeaders encodes the response headers worth replaying as a JSON object
+func storedHeaders(header http.Header) []byte {
+	headers := make(map[string]string)
+
+	for _, name := range replayedHeaders {
+		if value := header.Get(name); value != "" {
+			headers[name] = value
+		}
+	}
+
+	if len(headers) == 0 {
+		return nil
+	}
+
+	encoded, err := json.Marshal(headers)
+
+	if err != nil {
+		return nil
+	}
+
+	return encoded
+}
+
+// idempotent wraps a handler so requests carrying an Idempotency-Key header are
+// executed once, retries with the same key and body get the original response.
+// Reusing a key for a different request returns 422, retrying while the original
+// request is still running returns 409.
+func (s *Server) idempotent(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(IdempotencyKeyHeader)
+
+		if key == "" {
+			next(w, r)
+			return
+		}
+
+		if len(key) > maxIdempotencyKeyLength {
+			s.respondWithError(w, http.StatusBadRequest, "Idempotency-Key must be at most 255 characters")
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxIdempotentBodySize+1))
+		r.Body.Close()
+
+		if err != nil || len(body) > maxIdempotentBodySize {
+			s.respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+			return
+		}
+
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		ctx := r.Context()
+		now := time.Now().UTC()
+		idempotencyKey := &models.IdempotencyKey{
+			Key:           key,
+			RequestMethod: r.Method,
+			RequestPath:   r.URL.Path,
+			RequestHash:   requestFingerprint(body),
+			LockedAt:      now,
+		}
+
+		acquired, err := s.idempotencyRepo.Acquire(ctx, idempotencyKey, now.Add(-idempotencyLockTimeout), now.Add(-idempotencyKeyTTL))
+
+		if err != nil {
+			s.logger.Error("Failed to acquire idempotency key", "error", err, "key", key)
+			s.respondWithError(w, http.StatusInternalServerError, "Failed to process idempotency key")
+			return
+		}
+
+		if !acquired {
+			s.replayIdempotentResponse(w, r, idempotencyKey)
+			return
+		}
+
+		recorder := &idempotencyRecorder{ResponseWriter: w}
+		next(recorder, r)
+
+		// Store the outcome even if the client went away, that's when it will retry
+		storeCtx := context.WithoutCancel(ctx)
+
+		// Server errors may be transient, let the client retry them with the same key
+		if recorder.status == 0 || recorder.status >= http.StatusInternalServerError {
+			if err := s.idempotencyRepo.Release(storeCtx, key); err != nil {
+				s.logger.Error("Failed to release idempotency key", "error", err, "key", key)
+			}
+			return
+		}
+
+		if err := s.idempotencyRepo.Complete(storeCtx, key, recorder.status, storedHeaders(recorder.Header()), recorder.body.Bytes()); err != nil {
+			s.logger.Error("Failed to store idempotent response", "error", err, "key", key)
+		}
+	}
+}
+
+// replayIdempotentResponse answers a request whose idempotency key is already in use
+func (s *Server) replayIdempotentResponse(w http.ResponseWriter, r *http.Request, requested *models.IdempotencyKey) {
+	existing, err := s.idempotencyRepo.Get(r.Context(), requested.Key)
+
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			// The original request failed and released the key in the meantime
+			w.Header().Set("Retry-After", "1")
+			s.respondWithError(w, http.StatusConflict, "A request with this Idempotency-Key is in progress")
+			return
+		}
+		s.logger.Error("Failed to get idempotency key", "error", err, "key", requested.Key)
+		s.respondWithError(w, http.StatusInternalServerError, "Failed to process idempotency key")
+		return
+	}
+
+	if existing.RequestMethod != requested.RequestMethod ||
+		existing.RequestPath != requested.RequestPath ||
+		existing.RequestHash != requested.RequestHash {
+		s.respondWithError(w, http.StatusUnprocessableEntity, "Idempotency-Key was already used for a different request")
+		return
+	}
+
+	if !existing.Completed() {
+		w.Header().Set("Retry-After", "1")
+		s.respondWithError(w, http.StatusConflict, "A request with this Idempotency-Key is in progress")
+		return
+	}
+
+	s.logger.Info("Replaying idempotent response", "key", existing.Key, "path", existing.RequestPath)
+
+	var headers map[string]string
+
+	if len(existing.ResponseHeaders) > 0 {
+		if err := json.Unmarshal(existing.ResponseHeaders, &headers); err != nil {
+			s.logger.Warn("Failed to decode stored response headers", "error", err, "key", existing.Key)
+		}
+	}
+
+	for name, value := range headers {
+		w.Header().Set(name, value)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set(IdempotentReplayedHeader, "true")
+	w.WriteHeader(*existing.ResponseStatus)
+	w.Write(existing.ResponseBody)
+}
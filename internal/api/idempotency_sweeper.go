@@ -0,0 +1,124 @@
+package api
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/vaidashi/fault-tolerant-api/internal/repository"
+	"github.com/vaidashi/fault-tolerant-api/pkg/logger"
+)
+
+const (
+	// idempotencySweepInterval is how often expired idempotency keys are removed
+	idempotencySweepInterval = 1 * time.Hour
+	// idempotencySweepBatchSize is the number of keys removed per statement
+	idempotencySweepBatchSize = 500
+)
+
+// IdempotencySweeper periodically removes idempotency keys older than their TTL
+type IdempotencySweeper struct {
+	idempotencyRepo *repository.IdempotencyRepository
+	interval        time.Duration
+	ttl             time.Duration
+	batchSize       int
+	logger          logger.Logger
+	ctx             context.Context
+	cancel          context.CancelFunc
+	wg              sync.WaitGroup
+	running         bool
+	mu              sync.Mutex
+}
+
+// NewIdempotencySweeper creates a new IdempotencySweeper
+func NewIdempotencySweeper(idempotencyRepo *repository.IdempotencyRepository, logger logger.Logger) *IdempotencySweeper {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &IdempotencySweeper{
+		idempotencyRepo: idempotencyRepo,
+		interval:        idempotencySweepInterval,
+		ttl:             idempotencyKeyTTL,
+		batchSize:       idempotencySweepBatchSize,
+		logger:          logger,
+		ctx:             ctx,
+		cancel:          cancel,
+		running:         false,
+	}
+}
+
+// Start starts the idempotency sweeper
+func (s *IdempotencySweeper) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.running {
+		return
+	}
+
+	s.running = true
+	s.wg.Add(1)
+
+	go func() {
+		defer s.wg.Done()
+		s.runSweeper()
+	}()
+
+	s.logger.Info("Idempotency key sweeper started", "interval", s.interval, "ttl", s.ttl)
+}
+
+// Stop stops the idempotency sweeper
+func (s *IdempotencySweeper) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.running {
+		return
+	}
+
+	s.cancel()
+	s.wg.Wait()
+	s.running = false
+
+	s.logger.Info("Idempotency key sweeper stopped")
+}
+
+// runSweeper runs the sweep in a loop
+func (s *IdempotencySweeper) runSweeper() {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+			s.sweep(s.ctx)
+		}
+	}
+}
+
+// sweep removes expired idempotency keys in batches until none are left
+func (s *IdempotencySweeper) sweep(ctx context.Context) {
+	cutoff := time.Now().UTC().Add(-s.ttl)
+	var total int64
+
+	for ctx.Err() == nil {
+		removed, err := s.idempotencyRepo.DeleteCreatedBefore(ctx, cutoff, s.batchSize)
+
+		if err != nil {
+			s.logger.Error("Failed to sweep idempotency keys", "error", err, "removed", total)
+			return
+		}
+
+		total += removed
+
+		// A partial batch means nothing older than the cutoff is left
+		if removed < int64(s.batchSize) {
+			break
+		}
+	}
+
+	if total > 0 {
+		s.logger.Info("Expired idempotency keys removed", "removed", total, "cutoff", cutoff)
+	}
+}
@@ -0,0 +1,302 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/vaidashi/fault-tolerant-api/internal/models"
+	"github.com/vaidashi/fault-tolerant-api/internal/outbox"
+	"github.com/vaidashi/fault-tolerant-api/internal/repository"
+)
+
+// getOutboxMessagesHandler returns a filtered, paginated list of outbox messages
+func (s *Server) getOutboxMessagesHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	query := r.URL.Query()
+
+	// Parse pagination parameters
+	page, err := strconv.Atoi(query.Get("page"))
+
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	pageSize, err := strconv.Atoi(query.Get("pageSize"))
+
+	if err != nil || pageSize < 1 || pageSize > 100 {
+		pageSize = 10
+	}
+
+	offset := (page - 1) * pageSize
+
+	filter := &repository.OutboxFilter{
+		Status:        query.Get("status"),
+		EventType:     query.Get("event_type"),
+		AggregateType: query.Get("aggregate_type"),
+		AggregateID:   query.Get("aggregate_id"),
+	}
+
+	if filter.CreatedAfter, err = parseTimeParam(query.Get("from")); err != nil {
+		s.respondWithError(w, http.StatusBadRequest, "Invalid from time, expected RFC3339")
+		return
+	}
+
+	if filter.CreatedBefore, err = parseTimeParam(query.Get("to")); err != nil {
+		s.respondWithError(w, http.StatusBadRequest, "Invalid to time, expected RFC3339")
+		return
+	}
+
+	messages, err := s.outboxRepo.List(ctx, filter, pageSize, offset)
+
+	if err != nil {
+		s.logger.Error("Failed to fetch outbox messages", "error", err)
+		s.respondWithError(w, http.StatusInternalServerError, "Failed to fetch outbox messages")
+		return
+	}
+
+	totalCount, err := s.outboxRepo.Count(ctx, filter)
+
+	if err != nil {
+		s.logger.Error("Failed to count outbox messages", "error", err)
+	}
+
+	response := PaginationResponse{
+		Items:      messages,
+		TotalCount: totalCount,
+		Page:       page,
+		PageSize:   pageSize,
+		Offset:     offset,
+		Status:     filter.Status,
+	}
+
+	s.respondWithJSON(w, http.StatusOK, ApiResponse{Success: true, Data: response})
+}
+
+// getOutboxMessageHandler returns a single outbox message
+func (s *Server) getOutboxMessageHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+
+	id, err := strconv.ParseInt(vars["id"], 10, 64)
+
+	if err != nil {
+		s.respondWithError(w, http.StatusBadRequest, "Invalid message ID")
+		return
+	}
+
+	message, err := s.outboxRepo.GetMessage(ctx, id)
+
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			s.respondWithError(w, http.StatusNotFound, "Outbox message not found")
+			return
+		}
+		s.logger.Error("Failed to fetch outbox message", "error", err, "messageID", id)
+		s.respondWithError(w, http.StatusInternalServerError, "Failed to fetch outbox message")
+		return
+	}
+
+	s.respondWithJSON(w, http.StatusOK, ApiResponse{Success: true, Data: message})
+}
+
+// requeueOutboxMessageHandler returns a failed outbox message to the queue
+func (s *Server) requeueOutboxMessageHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	idStr := vars["id"]
+
+	id, err := strconv.ParseInt(idStr, 10, 64)
+
+	if err != nil {
+		s.respondWithError(w, http.StatusBadRequest, "Invalid message ID")
+		return
+	}
+
+	message, err := s.outboxRepo.GetMessage(ctx, id)
+
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			s.respondWithError(w, http.StatusNotFound, "Outbox message not found")
+			return
+		}
+		s.logger.Error("Failed to fetch outbox message", "error", err, "messageID", id)
+		s.respondWithError(w, http.StatusInternalServerError, "Failed to fetch outbox message")
+		return
+	}
+
+	// Allow only failed messages to be requeued
+	if message.Status != models.OutboxStatusFailed {
+		s.respondWithError(w, http.StatusConflict, "Only failed messages can be requeued")
+		return
+	}
+
+	if err := s.outboxRepo.Requeue(ctx, id); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			s.respondWithError(w, http.StatusConflict, "Outbox message is no longer failed")
+			return
+		}
+		s.logger.Error("Failed to requeue outbox message", "error", err, "messageID", id)
+		s.respondWithError(w, http.StatusInternalServerError, "Failed to requeue outbox message")
+		return
+	}
+
+	// The message is delivered from the outbox again, so its dead letter is no longer needed
+	if err := s.dlqRepo.ResolveByOriginalMessageID(ctx, id, models.DeadLetterActorAdminAPI); err != nil {
+		s.logger.Error("Failed to resolve dead letters for requeued message", "error", err, "messageID", id)
+	}
+
+	s.respondWithJSON(w, http.StatusOK, ApiResponse{
+		Success: true,
+		Data: map[string]string{
+			"message": "Outbox message requeued",
+			"id":      idStr,
+		},
+	})
+}
+
+// replayAggregateHandler queues the history of an aggregate to be published again
+func (s *Server) replayAggregateHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req struct {
+		AggregateType string `json:"aggregate_type"`
+		AggregateID   string `json:"aggregate_id"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+
+	if err := decoder.Decode(&req); err != nil {
+		s.respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	if req.AggregateID == "" {
+		s.respondWithError(w, http.StatusBadRequest, "Aggregate ID is required")
+		return
+	}
+
+	if req.AggregateType == "" {
+		req.AggregateType = "order"
+	}
+
+	ids, err := s.outboxRepo.ReplayAggregate(ctx, req.AggregateType, req.AggregateID)
+
+	if err != nil {
+		s.logger.Error("Failed to replay aggregate", "error", err, "aggregateID", req.AggregateID)
+		s.respondWithError(w, http.StatusInternalServerError, "Failed to replay aggregate")
+		return
+	}
+
+	if len(ids) == 0 {
+		s.respondWithError(w, http.StatusNotFound, "No completed messages found for aggregate")
+		return
+	}
+
+	s.logger.Info("Aggregate history queued for replay",
+		"aggregateType", req.AggregateType,
+		"aggregateID", req.AggregateID,
+		"count", len(ids))
+
+	s.respondWithJSON(w, http.StatusAccepted, ApiResponse{
+		Success: true,
+		Data: map[string]interface{}{
+			"message":        "Aggregate history queued for replay",
+			"aggregate_type": req.AggregateType,
+			"aggregate_id":   req.AggregateID,
+			"message_ids":    ids,
+		},
+	})
+}
+
+// purgeOutboxMessagesHandler deletes completed or failed outbox messages matching a filter
+func (s *Server) purgeOutboxMessagesHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	query := r.URL.Query()
+
+	filter := &repository.OutboxFilter{
+		Status:        query.Get("status"),
+		EventType:     query.Get("event_type"),
+		AggregateType: query.Get("aggregate_type"),
+		AggregateID:   query.Get("aggregate_id"),
+	}
+
+	// Never purge messages that still have to be delivered
+	if filter.Status != string(models.OutboxStatusCompleted) && filter.Status != string(models.OutboxStatusFailed) {
+		s.respondWithError(w, http.StatusBadRequest, "Status must be completed or failed")
+		return
+	}
+
+	var err error
+
+	if filter.CreatedAfter, err = parseTimeParam(query.Get("from")); err != nil {
+		s.respondWithError(w, http.StatusBadRequest, "Invalid from time, expected RFC3339")
+		return
+	}
+
+	if filter.CreatedBefore, err = parseTimeParam(query.Get("to")); err != nil {
+		s.respondWithError(w, http.StatusBadRequest, "Invalid to time, expected RFC3339")
+		return
+	}
+
+	purged, err := s.outboxRepo.Purge(ctx, filter)
+
+	if err != nil {
+		s.logger.Error("Failed to purge outbox messages", "error", err)
+		s.respondWithError(w, http.StatusInternalServerError, "Failed to purge outbox messages")
+		return
+	}
+
+	s.logger.Info("Outbox messages purged", "status", filter.Status, "count", purged)
+
+	s.respondWithJSON(w, http.StatusOK, ApiResponse{
+		Success: true,
+		Data: map[string]interface{}{
+			"message": "Outbox messages purged",
+			"purged":  purged,
+		},
+	})
+}
+
+// parseTimeParam parses an optional RFC3339 query parameter
+func parseTimeParam(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Timestamps are stored in UTC
+	t = t.UTC()
+	return &t, nil
+}
+
+// getOutboxRetentionHandler returns the outbox retention worker metrics
+func (s *Server) getOutboxRetentionHandler(w http.ResponseWriter, r *http.Request) {
+	s.respondWithJSON(w, http.StatusOK, ApiResponse{Success: true, Data: s.retentionWorker.GetMetrics()})
+}
+
+// runOutboxRetentionHandler triggers an outbox retention run
+func (s *Server) runOutboxRetentionHandler(w http.ResponseWriter, r *http.Request) {
+	result, err := s.retentionWorker.RunOnce(r.Context())
+
+	if err != nil {
+		if errors.Is(err, outbox.ErrRetentionRunning) {
+			s.respondWithError(w, http.StatusConflict, "Retention run already in progress")
+			return
+		}
+		s.logger.Error("Failed to run outbox retention", "error", err)
+		s.respondWithError(w, http.StatusInternalServerError, "Failed to run outbox retention")
+		return
+	}
+
+	s.respondWithJSON(w, http.StatusOK, ApiResponse{Success: true, Data: result})
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"slices"
 	"time"
 
 	"github.com/gorilla/mux"
@@ -16,8 +17,10 @@ import (
 	"github.com/vaidashi/fault-tolerant-api/internal/handlers"
 	"github.com/vaidashi/fault-tolerant-api/pkg/kafka"
 	"github.com/vaidashi/fault-tolerant-api/pkg/retry"
+	"github.com/vaidashi/fault-tolerant-api/pkg/tracing"
 	"github.com/vaidashi/fault-tolerant-api/internal/clients"
 	"github.com/vaidashi/fault-tolerant-api/pkg/middleware"
+	"github.com/vaidashi/fault-tolerant-api/pkg/circuitbreaker"
 )
 
 type Server struct {
@@ -29,17 +32,23 @@ type Server struct {
 	orderRepo *repository.OrderRepository
 	outboxRepo *repository.OutboxRepository
 	outboxProcessor *outbox.Processor
+	retentionWorker *outbox.RetentionWorker
 	orderService *service.OrderService
 	kafkaProducer *kafka.Producer
 	kafkaConsumer *kafka.Consumer
+	fileSink *outbox.FileHandler
 	dlqRepo *repository.DeadLetterRepository
 	deadLetterProcessor *outbox.DeadLetterProcessor
+	deadLetterJobs *outbox.DeadLetterJobManager
 	warehouseClient *clients.WarehouseClient
 	shipmentRepo *repository.ShipmentRepository
+	idempotencyRepo *repository.IdempotencyRepository
+	idempotencySweeper *IdempotencySweeper
 	shipmentService *service.ShipmentService
 	rateLimiter *middleware.RateLimiterMiddleware
 	endpointRateLimiter *middleware.EndpointRateLimiterMiddleware
 	gracefulDegradation *middleware.GracefulDegradation
+	breakerRegistry *circuitbreaker.Registry
 }
 
 // NewServer creates a new API server with the given configuration and logger.
@@ -59,17 +68,39 @@ func NewServer(cfg *config.Config, logger logger.Logger) *Server {
 		panic(err)
 	}
 
+	// Initialize circuit breaker registry and log every state transition
+	breakerRegistry := circuitbreaker.NewRegistry()
+	breakerRegistry.OnStateChange(func(name string, from, to circuitbreaker.State) {
+		logger.Warn("Circuit breaker state changed",
+			"breaker", name,
+			"from", from.String(),
+			"to", to.String())
+	})
+
 	// Initialize warehouse client
-	warehouseClient := clients.NewWarehouseClient(cfg.WarehouseURL, logger)
+	warehouseClient := clients.NewWarehouseClient(cfg.WarehouseURL, breakerRegistry, logger)
 	
 	// Initialize repositories
 	orderRepo := repository.NewOrderRepository(db, logger)
 	outboxRepo := repository.NewOutboxRepository(db, logger)
 	dlqRepo := repository.NewDeadLetterRepository(db, logger)
 	shipmentRepo := repository.NewShipmentRepository(db, logger)
+	idempotencyRepo := repository.NewIdempotencyRepository(db, logger)
+	idempotencySweeper := NewIdempotencySweeper(idempotencyRepo, logger)
 
 	// Initialize Kafka producer
-    kafkaProducer, err := kafka.NewProducer(cfg.Kafka.Brokers, logger)
+    producerConfig := &kafka.ProducerConfig{
+        Brokers:     cfg.Kafka.Brokers,
+        Async:       cfg.Kafka.ProducerMode == "async",
+        BatchSize:   100,
+        BatchBytes:  1024 * 1024,
+        Linger:      10 * time.Millisecond,
+        Compression: cfg.Kafka.Compression,
+        Idempotent:  cfg.Kafka.Idempotent,
+        TransactionalID: cfg.Kafka.TransactionalID,
+    }
+
+    kafkaProducer, err := kafka.NewProducer(producerConfig, logger)
 
     if err != nil {
         logger.Error("Failed to create Kafka producer", "error", err)
@@ -77,20 +108,41 @@ func NewServer(cfg *config.Config, logger logger.Logger) *Server {
     }
 
 	// Initialize services
-	orderService := service.NewOrderService(orderRepo, outboxRepo, logger)
-	shipmentService := service.NewShipmentService(shipmentRepo, orderRepo, outboxRepo, warehouseClient, logger)
+	orderStateMachine := service.NewOrderStateMachine()
+	orderService := service.NewOrderService(orderRepo, outboxRepo, orderStateMachine, logger)
+	shipmentService := service.NewShipmentService(shipmentRepo, orderRepo, outboxRepo, warehouseClient, orderStateMachine, logger)
 
 	// Initialize outbox processor
 	backoffStrategy := retry.NewDefaultExponentialBackoff()
 	processorConfig := &outbox.ProcessorConfig{
-		PollingInterval: 5 * time.Second,
+		PollingInterval: 30 * time.Second, // Fallback when notifications are missed
+		UseNotify:       true,
 		BatchSize:       10,
+		Concurrency:     4,
+		Pipelined:       producerConfig.Async,
+		InstanceID:      cfg.InstanceID,
+		LeaseDuration:   2 * time.Minute,
+		ReaperInterval:  30 * time.Second,
 		MaxRetries:      3,
 		BackoffStrategy: backoffStrategy,
 		UseDLQ:          true, 
 	}
+
+	// Larger batches let the async producer fill its batches
+	if producerConfig.Async {
+		processorConfig.BatchSize = 100
+	}
+
 	outboxProcessor := outbox.NewProcessor(outboxRepo, dlqRepo, logger, processorConfig)
 
+	// Initialize outbox retention worker
+	retentionWorker := outbox.NewRetentionWorker(outboxRepo, logger, &outbox.RetentionConfig{
+		Interval:  1 * time.Hour,
+		MaxAge:    7 * 24 * time.Hour, // Keep completed messages for a week
+		BatchSize: 500,
+		Archive:   false,
+	})
+
 	// Create the dead letter processor
     dlqProcessorConfig := &outbox.DeadLetterProcessorConfig{
         PollingInterval: 30 * time.Second, // Process less frequently than outbox
@@ -107,24 +159,29 @@ func NewServer(cfg *config.Config, logger logger.Logger) *Server {
 	// Initialize dead letter processor
     deadLetterProcessor := outbox.NewDeadLetterProcessor(dlqRepo, outboxRepo, logger, dlqProcessorConfig)
     
-	// Register message handlers
+	// Register message handlers, each event type goes to the sink configured for it
     kafkaHandler := outbox.NewKafkaHandler(kafkaProducer, cfg.Kafka.OrdersTopic, logger)
-    
-	// Register handlers for different event types for outbox processor
-	outboxProcessor.RegisterHandler("order_created", kafkaHandler)
-    outboxProcessor.RegisterHandler("order_updated", kafkaHandler)
-    outboxProcessor.RegisterHandler("order_status_changed", kafkaHandler)
 
-	// For dead letter queue (same handlers)
-    deadLetterProcessor.RegisterHandler("order_created", kafkaHandler)
-    deadLetterProcessor.RegisterHandler("order_updated", kafkaHandler)
-    deadLetterProcessor.RegisterHandler("order_status_changed", kafkaHandler)
+    sinks, fileSink, err := newOutboxSinks(cfg, kafkaHandler, logger)
+
+    if err != nil {
+        logger.Error("Failed to create outbox sinks", "error", err)
+        panic(err)
+    }
+
+	for eventType, handler := range sinks {
+		outboxProcessor.RegisterHandler(eventType, handler)
+		// For dead letter queue (same handlers)
+		deadLetterProcessor.RegisterHandler(eventType, handler)
+	}
 
 	// Initialize Kafka consumer
     consumerConfig := &kafka.ConsumerConfig{
         Brokers:       cfg.Kafka.Brokers,
         Topics:        []string{cfg.Kafka.OrdersTopic},
         ConsumerGroup: cfg.Kafka.ConsumerGroup,
+        RetryDelays:   []time.Duration{5 * time.Second, 30 * time.Second, 5 * time.Minute},
+        Producer:      kafkaProducer,
     }
 
 	kafkaConsumer, err := kafka.NewConsumer(consumerConfig, logger)
@@ -135,7 +192,8 @@ func NewServer(cfg *config.Config, logger logger.Logger) *Server {
     }
 
 	// Register event handlers for Kafka consumer
-    orderEventsHandler := handlers.NewOrderEventsHandler(logger)
+    processedEventRepo := repository.NewProcessedEventRepository(db, logger)
+    orderEventsHandler := handlers.NewOrderEventsHandler(processedEventRepo, logger)
     kafkaConsumer.RegisterHandler(cfg.Kafka.OrdersTopic, orderEventsHandler)
 
 	// Initialize rate limiters
@@ -150,7 +208,13 @@ func NewServer(cfg *config.Config, logger logger.Logger) *Server {
 	}
 
 	rateLimiter := middleware.NewRateLimiterMiddleware(rateLimiterConfig, logger)
-	gracefulDegradation := middleware.NewGracefulDegradation(logger)
+	inboundBreakerMode := circuitbreaker.ModeConsecutiveFailures
+
+	if cfg.InboundBreakerMode == "window" {
+		inboundBreakerMode = circuitbreaker.ModeSlidingWindow
+	}
+
+	gracefulDegradation := middleware.NewGracefulDegradation(breakerRegistry, inboundBreakerMode, logger)
 	
 	// Initialize endpoint rate limiter
 	endpointRateLimiter := middleware.NewEndpointRateLimiterMiddleware(50, 10, logger)
@@ -175,22 +239,30 @@ func NewServer(cfg *config.Config, logger logger.Logger) *Server {
 		outboxRepo: outboxRepo,
 		orderService: orderService,
 		outboxProcessor: outboxProcessor,
+		retentionWorker: retentionWorker,
 		kafkaProducer: kafkaProducer,
 		kafkaConsumer: kafkaConsumer,
+		fileSink: fileSink,
 		dlqRepo: dlqRepo,
 		deadLetterProcessor: deadLetterProcessor,
+		deadLetterJobs: outbox.NewDeadLetterJobManager(dlqRepo, deadLetterProcessor, 50, logger),
 		warehouseClient: warehouseClient,
 		shipmentRepo: shipmentRepo,
+		idempotencyRepo: idempotencyRepo,
+		idempotencySweeper: idempotencySweeper,
 		shipmentService: shipmentService,
 		rateLimiter: rateLimiter,
 		endpointRateLimiter: endpointRateLimiter,
 		gracefulDegradation: gracefulDegradation,
+		breakerRegistry: breakerRegistry,
 	}
 	
 	server.setupRoutes()
 	// Start the processors
 	outboxProcessor.Start()
 	deadLetterProcessor.Start()
+	retentionWorker.Start()
+	idempotencySweeper.Start()
 
 	// Start the Kafka consumer
     if err := kafkaConsumer.Start(); err != nil {
@@ -201,6 +273,84 @@ func NewServer(cfg *config.Config, logger logger.Logger) *Server {
 	return server
 }
 
+// outboxEventTypes are the event types published through the outbox
+var outboxEventTypes = []string{"order_created", "order_updated", "order_status_changed"}
+
+// newOutboxSinks resolves the configured sink for every outbox event type,
+// sinks are only created when at least one event type uses them
+func newOutboxSinks(cfg *config.Config, kafkaHandler *outbox.KafkaHandler, logger logger.Logger) (map[string]outbox.MessageHandler, *outbox.FileHandler, error) {
+	created := map[string]outbox.MessageHandler{
+		"kafka": kafkaHandler,
+	}
+	var fileSink *outbox.FileHandler
+
+	// A mapping for an event type we don't publish is most likely a typo
+	for eventType := range cfg.Outbox.Sinks {
+		if !slices.Contains(outboxEventTypes, eventType) {
+			return nil, nil, fmt.Errorf("unknown outbox event type %q in OUTBOX_SINKS", eventType)
+		}
+	}
+
+	sinkFor := func(name string) (outbox.MessageHandler, error) {
+		if handler, ok := created[name]; ok {
+			return handler, nil
+		}
+
+		var handler outbox.MessageHandler
+
+		switch name {
+		case "webhook":
+			if cfg.Outbox.WebhookURL == "" {
+				return nil, fmt.Errorf("webhook sink requires WEBHOOK_URL")
+			}
+
+			if cfg.Outbox.WebhookSecret == "" {
+				return nil, fmt.Errorf("webhook sink requires WEBHOOK_SECRET")
+			}
+
+			handler = outbox.NewWebhookHandler(cfg.Outbox.WebhookURL, cfg.Outbox.WebhookSecret, cfg.Outbox.WebhookTimeout, logger)
+		case "file":
+			fileHandler, err := outbox.NewFileHandler(cfg.Outbox.FilePath, logger)
+
+			if err != nil {
+				return nil, err
+			}
+
+			fileSink = fileHandler
+			handler = fileHandler
+		case "log":
+			handler = outbox.NewLoggingHandler(logger)
+		case "memory":
+			handler = outbox.NewMemoryHandler()
+		default:
+			return nil, fmt.Errorf("unknown outbox sink %q", name)
+		}
+
+		created[name] = handler
+		return handler, nil
+	}
+
+	sinks := make(map[string]outbox.MessageHandler, len(outboxEventTypes))
+
+	for _, eventType := range outboxEventTypes {
+		name := cfg.Outbox.SinkFor(eventType)
+		handler, err := sinkFor(name)
+
+		if err != nil {
+			if fileSink != nil {
+				fileSink.Close()
+			}
+
+			return nil, nil, fmt.Errorf("event type %s: %w", eventType, err)
+		}
+
+		logger.Info("Outbox sink configured", "eventType", eventType, "sink", name)
+		sinks[eventType] = handler
+	}
+
+	return sinks, fileSink, nil
+}
+
 // Start starts the HTTP server 
 func (s *Server) Start() error {
 	return s.httpServer.ListenAndServe()
@@ -210,7 +360,10 @@ func (s *Server) Start() error {
 func (s *Server) Shutdown(ctx context.Context) error {
 	// Stop the processors
     s.outboxProcessor.Stop()
+	s.deadLetterJobs.Stop()
 	s.deadLetterProcessor.Stop()
+	s.retentionWorker.Stop()
+	s.idempotencySweeper.Stop()
 
 	// Stop rate limiters
 	s.rateLimiter.Stop()
@@ -229,6 +382,13 @@ func (s *Server) Shutdown(ctx context.Context) error {
         }
     }
     
+    // Close the outbox file sink
+    if s.fileSink != nil {
+        if err := s.fileSink.Close(); err != nil {
+            s.logger.Error("Error closing outbox file sink", "error", err)
+        }
+    }
+
     // Close database connection
     if err := s.db.Close(); err != nil {
         s.logger.Error("Error closing database connection", "error", err)
@@ -240,6 +400,7 @@ func (s *Server) Shutdown(ctx context.Context) error {
 // setupRoutes configures all the routes for our API
 func (s *Server) setupRoutes() {
 	// Add middleware for all routes
+	s.router.Use(middleware.TracingMiddleware)
 	s.router.Use(s.loggingMiddleware)
 	// Add graceful degradation middleware
 	s.router.Use(s.gracefulDegradation.Middleware)
@@ -256,7 +417,7 @@ func (s *Server) setupRoutes() {
 	
 	// Resource endpoints
 	api.HandleFunc("/orders", s.getOrdersHandler).Methods(http.MethodGet)
-	api.HandleFunc("/orders", s.createOrderHandler).Methods(http.MethodPost)
+	api.HandleFunc("/orders", s.idempotent(s.createOrderHandler)).Methods(http.MethodPost)
 	api.HandleFunc("/orders/{id}", s.getOrderByIDHandler).Methods(http.MethodGet)
 	api.HandleFunc("/orders/{id}", s.updateOrderHandler).Methods(http.MethodPut)
 	api.HandleFunc("/orders/{id}", s.deleteOrderHandler).Methods(http.MethodDelete)
@@ -265,15 +426,34 @@ func (s *Server) setupRoutes() {
 	 // Admin API for monitoring and management
     admin := s.router.PathPrefix("/api/v1/admin").Subrouter()
     admin.HandleFunc("/dead-letters", s.getDeadLettersHandler).Methods(http.MethodGet)
+	admin.HandleFunc("/dead-letters/bulk/retry", s.bulkRetryDeadLettersHandler).Methods(http.MethodPost)
+	admin.HandleFunc("/dead-letters/bulk/discard", s.bulkDiscardDeadLettersHandler).Methods(http.MethodPost)
+	admin.HandleFunc("/dead-letters/jobs", s.getDeadLetterJobsHandler).Methods(http.MethodGet)
+	admin.HandleFunc("/dead-letters/jobs/{id}", s.getDeadLetterJobHandler).Methods(http.MethodGet)
+	admin.HandleFunc("/dead-letters/jobs/{id}/cancel", s.cancelDeadLetterJobHandler).Methods(http.MethodPost)
     admin.HandleFunc("/dead-letters/{id}/retry", s.retryDeadLetterHandler).Methods(http.MethodPost)
     admin.HandleFunc("/dead-letters/{id}/discard", s.discardDeadLetterHandler).Methods(http.MethodPost)
+	admin.HandleFunc("/dead-letters/{id}/payload", s.editDeadLetterPayloadHandler).Methods(http.MethodPut)
+	admin.HandleFunc("/dead-letters/{id}/edits", s.getDeadLetterEditsHandler).Methods(http.MethodGet)
+	admin.HandleFunc("/dead-letters/{id}/history", s.getDeadLetterHistoryHandler).Methods(http.MethodGet)
+	admin.HandleFunc("/orders/transitions", s.getOrderTransitionsHandler).Methods(http.MethodGet)
+	admin.HandleFunc("/outbox", s.getOutboxMessagesHandler).Methods(http.MethodGet)
+	admin.HandleFunc("/outbox", s.purgeOutboxMessagesHandler).Methods(http.MethodDelete)
+	admin.HandleFunc("/outbox/replay", s.replayAggregateHandler).Methods(http.MethodPost)
+	admin.HandleFunc("/outbox/retention", s.getOutboxRetentionHandler).Methods(http.MethodGet)
+	admin.HandleFunc("/outbox/retention/run", s.runOutboxRetentionHandler).Methods(http.MethodPost)
+	admin.HandleFunc("/outbox/{id}", s.getOutboxMessageHandler).Methods(http.MethodGet)
+	admin.HandleFunc("/outbox/{id}/requeue", s.requeueOutboxMessageHandler).Methods(http.MethodPost)
 	admin.HandleFunc("/rate-limits", s.getRateLimitsHandler).Methods(http.MethodGet)
 	admin.HandleFunc("/rate-limits/endpoint", s.setEndpointRateLimitHandler).Methods(http.MethodPost)
 	admin.HandleFunc("/circuit-breaker", s.getCircuitBreakerStatusHandler).Methods(http.MethodGet)
 	admin.HandleFunc("/circuit-breaker/reset", s.resetCircuitBreakerHandler).Methods(http.MethodPost)
+	admin.HandleFunc("/circuit-breaker/{name}", s.getNamedCircuitBreakerHandler).Methods(http.MethodGet)
+	admin.HandleFunc("/circuit-breaker/{name}/reset", s.resetNamedCircuitBreakerHandler).Methods(http.MethodPost)
+	admin.HandleFunc("/circuit-breaker/{name}/open", s.forceOpenCircuitBreakerHandler).Methods(http.MethodPost)
 
 	// Shipment endpoints
-	api.HandleFunc("/orders/{id}/shipments", s.createShipmentHandler).Methods(http.MethodPost)
+	api.HandleFunc("/orders/{id}/shipments", s.idempotent(s.createShipmentHandler)).Methods(http.MethodPost)
 	api.HandleFunc("/orders/{id}/shipments", s.getShipmentsForOrderHandler).Methods(http.MethodGet)
 	api.HandleFunc("/shipments/{id}", s.getShipmentHandler).Methods(http.MethodGet)
 	api.HandleFunc("/shipments/{id}/sync", s.syncShipmentHandler).Methods(http.MethodPost)
@@ -293,6 +473,7 @@ func (s *Server) loggingMiddleware(next http.Handler) http.Handler {
 			"path", r.URL.Path,
 			"duration", time.Since(start),
 			"remoteAddr", r.RemoteAddr,
+			"correlationID", tracing.CorrelationID(r.Context()),
 		)
 	})
 }
\ No newline at end of file
@@ -6,6 +6,8 @@ import (
 
 	"github.com/gorilla/mux"
 	"github.com/vaidashi/fault-tolerant-api/internal/repository"
+	"github.com/vaidashi/fault-tolerant-api/internal/service"
+	apperrors "github.com/vaidashi/fault-tolerant-api/pkg/errors"
 )
 
 // createShipmentHandler handles the creation of a shipment for an order
@@ -14,18 +16,37 @@ func (s *Server) createShipmentHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	orderID := vars["id"]
 
-	shipment, err := s.shipmentService.CreateShipmentForOrder(ctx, orderID)
+	shipment, created, err := s.shipmentService.CreateShipmentForOrder(ctx, orderID)
 
 	if err != nil {
 		if errors.Is(err, repository.ErrNotFound) {
 			s.respondWithError(w, http.StatusNotFound, "Order not found")
 			return
 		}
+		if errors.Is(err, service.ErrOrderNotShippable) {
+			s.respondWithError(w, http.StatusUnprocessableEntity, "Order has no items or shipping address to ship")
+			return
+		}
+		if errors.Is(err, service.ErrIllegalTransition) {
+			s.respondWithError(w, http.StatusConflict, err.Error())
+			return
+		}
+		if errors.Is(err, apperrors.ErrServiceUnavailable) {
+			w.Header().Set("Retry-After", "30")
+			s.respondWithError(w, http.StatusServiceUnavailable, "Warehouse service is temporarily unavailable")
+			return
+		}
 		s.logger.Error("Failed to create shipment", "error", err, "orderID", orderID)
 		s.respondWithError(w, http.StatusInternalServerError, "Failed to create shipment")
 		return
 	}
 
+	// The order already had a shipment, nothing new was created
+	if !created {
+		s.respondWithJSON(w, http.StatusOK, ApiResponse{Success: true, Data: shipment})
+		return
+	}
+
 	s.respondWithJSON(w, http.StatusCreated, ApiResponse{Success: true, Data: shipment})
 }
 
@@ -80,6 +101,15 @@ func (s *Server) syncShipmentHandler(w http.ResponseWriter, r *http.Request) {
 			s.respondWithError(w, http.StatusNotFound, "Shipment not found")
 			return
 		}
+		if errors.Is(err, service.ErrIllegalTransition) {
+			s.respondWithError(w, http.StatusConflict, err.Error())
+			return
+		}
+		if errors.Is(err, apperrors.ErrServiceUnavailable) {
+			w.Header().Set("Retry-After", "30")
+			s.respondWithError(w, http.StatusServiceUnavailable, "Warehouse service is temporarily unavailable")
+			return
+		}
 		s.logger.Error("Failed to sync shipment", "error", err, "shipmentID", id)
 		s.respondWithError(w, http.StatusInternalServerError, "Failed to sync shipment with warehouse")
 		return
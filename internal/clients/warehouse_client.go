@@ -10,6 +10,7 @@ import (
 	"time"
 	"context"
 
+	"github.com/vaidashi/fault-tolerant-api/pkg/circuitbreaker"
 	"github.com/vaidashi/fault-tolerant-api/pkg/errors"
 	"github.com/vaidashi/fault-tolerant-api/pkg/logger"
 	"github.com/vaidashi/fault-tolerant-api/pkg/retry"
@@ -21,8 +22,16 @@ type WarehouseClient struct {
 	httpClient *http.Client
 	logger     logger.Logger
 	retryConfig *retry.RetryConfig
+	breakers   map[string]*circuitbreaker.CircuitBreaker
 }
 
+// Circuit breaker names for each warehouse operation
+const (
+	BreakerCheckInventory    = "warehouse.check_inventory"
+	BreakerCreateShipment    = "warehouse.create_shipment"
+	BreakerGetShipmentStatus = "warehouse.get_shipment_status"
+)
+
 // InventoryResponse represents the response from the inventory check endpoint
 type InventoryResponse struct {
 	ProductID        string `json:"product_id,omitempty"`
@@ -33,15 +42,30 @@ type InventoryResponse struct {
 	Timestamp        string `json:"timestamp,omitempty"`
 }
 
+// ShipmentProduct is a product and quantity to ship
+type ShipmentProduct struct {
+	ProductID string `json:"product_id"`
+	Quantity  int    `json:"quantity"`
+}
+
 // ShipmentRequest represents the request to create a shipment
 type ShipmentRequest struct {
 	OrderID    string `json:"order_id"`
 	CustomerID string `json:"customer_id"`
-	Products   []struct {
-		ProductID string `json:"product_id"`
-		Quantity  int    `json:"quantity"`
-	} `json:"products"`
+	Products   []ShipmentProduct `json:"products"`
 	ShippingAddress string `json:"shipping_address,omitempty"`
+	// IdempotencyKey is sent as a header so the warehouse creates the shipment only once
+	IdempotencyKey string `json:"-"`
+}
+
+// IdempotencyKeyHeader is the header the warehouse uses to deduplicate requests
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// ShipmentIdempotencyKey derives the idempotency key for creating a shipment,
+// attempt counts the order's previous shipments that failed so every retry of
+// the same attempt reuses the key and a new attempt gets a fresh one
+func ShipmentIdempotencyKey(orderID string, attempt int) string {
+	return fmt.Sprintf("shipment:%s:%d", orderID, attempt)
 }
 
 // ShipmentResponse represents the response from the create shipment endpoint
@@ -56,7 +80,7 @@ type ShipmentResponse struct {
 }
 
 // NewWarehouseClient creates a new WarehouseClient instance
-func NewWarehouseClient(baseURL string, logger logger.Logger) *WarehouseClient {
+func NewWarehouseClient(baseURL string, registry *circuitbreaker.Registry, logger logger.Logger) *WarehouseClient {
 	httpClient := &http.Client{
 		Timeout: 5 * time.Second,
 	}
@@ -78,14 +102,62 @@ func NewWarehouseClient(baseURL string, logger logger.Logger) *WarehouseClient {
 		},
 	}
 
+	// Create a circuit breaker per operation so one failing endpoint
+	// doesn't block the others
+	breakerConfig := circuitbreaker.CircuitBreakerConfig{
+		FailureThreshold: 5,                // Open circuit after 5 failed calls
+		ResetTimeout:     30 * time.Second, // Wait 30 seconds before trying again
+		HalfOpenMaxCalls: 1,                // Allow a single probe in half-open state
+	}
+
+	breakers := map[string]*circuitbreaker.CircuitBreaker{
+		BreakerCheckInventory:    registry.Register(BreakerCheckInventory, breakerConfig),
+		BreakerCreateShipment:    registry.Register(BreakerCreateShipment, breakerConfig),
+		BreakerGetShipmentStatus: registry.Register(BreakerGetShipmentStatus, breakerConfig),
+	}
+
 	return &WarehouseClient{
 		baseURL:    baseURL,
 		httpClient: httpClient,
 		logger:     logger,
 		retryConfig: retryConfig,
+		breakers:   breakers,
 	}
 }
 
+// executeWithBreaker runs fn with retries, guarded by the named circuit breaker
+func (c *WarehouseClient) executeWithBreaker(ctx context.Context, name string, fn retry.RetryableFunc) error {
+	breaker := c.breakers[name]
+
+	if !breaker.Allow() {
+		c.logger.Warn("Warehouse circuit is open, failing fast", "breaker", name)
+		return errors.NewServiceUnavailableError(fmt.Sprintf("warehouse circuit breaker %s is open", name))
+	}
+
+	start := time.Now()
+	err := retry.Retry(ctx, fn, c.retryConfig)
+
+	if err != nil {
+		// The caller gave up, that says nothing about the warehouse even if the
+		// aborted call looks like a transient failure
+		if ctx.Err() != nil {
+			breaker.Release()
+			return err
+		}
+
+		// Only transient failures count against the warehouse, a 4xx means it is up
+		if errors.IsRetryable(err) {
+			breaker.RecordResult(false, time.Since(start))
+		} else {
+			breaker.RecordResult(true, time.Since(start))
+		}
+		return err
+	}
+
+	breaker.RecordResult(true, time.Since(start))
+	return nil
+}
+
 // CheckInventory checks the inventory for a product
 func (c *WarehouseClient) CheckInventory(ctx context.Context, productID string) (*InventoryResponse, error) {
 	url := fmt.Sprintf("%s/api/v1/inventory/%s", c.baseURL, productID)
@@ -155,8 +227,8 @@ func (c *WarehouseClient) CheckInventory(ctx context.Context, productID string)
 		return nil
 	}
 
-	// Execute with retry
-	err := retry.Retry(ctx, retryFunc, c.retryConfig)
+	// Execute with retry behind the circuit breaker
+	err := c.executeWithBreaker(ctx, BreakerCheckInventory, retryFunc)
 
 	if err != nil {
 		c.logger.Error("Failed to check inventory after retries", 
@@ -190,6 +262,10 @@ func (c *WarehouseClient) CreateShipment(ctx context.Context, request *ShipmentR
 
 		req.Header.Set("Content-Type", "application/json")
 
+		if request.IdempotencyKey != "" {
+			req.Header.Set(IdempotencyKeyHeader, request.IdempotencyKey)
+		}
+
 		resp, err := c.httpClient.Do(req)
 
 		if err != nil {
@@ -244,8 +320,8 @@ func (c *WarehouseClient) CreateShipment(ctx context.Context, request *ShipmentR
 		return nil
 	}
 
-	// Execute with retry
-	err := retry.Retry(ctx, retryFunc, c.retryConfig)
+	// Execute with retry behind the circuit breaker
+	err := c.executeWithBreaker(ctx, BreakerCreateShipment, retryFunc)
 
 	if err != nil {
 		c.logger.Error("Failed to create shipment after retries", 
@@ -326,8 +402,8 @@ func (c *WarehouseClient) GetShipmentStatus(ctx context.Context, shipmentID stri
 		return nil
 	}
 	
-	// Execute with retry
-	err := retry.Retry(ctx, retryFunc, c.retryConfig)
+	// Execute with retry behind the circuit breaker
+	err := c.executeWithBreaker(ctx, BreakerGetShipmentStatus, retryFunc)
 	
 	if err != nil {
 		c.logger.Error("Failed to get shipment status after retries", 
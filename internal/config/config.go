@@ -5,6 +5,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type Config struct {
@@ -13,7 +14,10 @@ type Config struct {
 	Env 	string
 	DB DBConfig
 	Kafka KafkaConfig
+	Outbox OutboxConfig
 	WarehouseURL string
+	InstanceID string
+	InboundBreakerMode string // consecutive or window, how the inbound HTTP breaker trips
 }
 
 // DBConfig holds the database configuration
@@ -31,6 +35,53 @@ type KafkaConfig struct {
 	Brokers []string
 	OrdersTopic string
 	ConsumerGroup string
+	ProducerMode string // sync or async
+	Compression string
+	Idempotent bool
+	TransactionalID string // Enables producer transactions, must be unique per instance
+}
+
+// OutboxConfig holds the outbox sink configuration
+type OutboxConfig struct {
+	DefaultSink string // Sink for event types without an entry in Sinks
+	Sinks map[string]string // Sink per event type: kafka, webhook, file, log or memory
+	WebhookURL string
+	WebhookSecret string
+	WebhookTimeout time.Duration
+	FilePath string // NDJSON file written by the file sink
+}
+
+// SinkFor returns the name of the sink configured for an event type
+func (c OutboxConfig) SinkFor(eventType string) string {
+	if sink, ok := c.Sinks[eventType]; ok {
+		return sink
+	}
+
+	return c.DefaultSink
+}
+
+// parseSinks parses a comma separated list of event_type=sink pairs
+func parseSinks(value string) (map[string]string, error) {
+	sinks := make(map[string]string)
+
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+
+		if pair == "" {
+			continue
+		}
+
+		eventType, sink, ok := strings.Cut(pair, "=")
+		eventType, sink = strings.TrimSpace(eventType), strings.TrimSpace(sink)
+
+		if !ok || eventType == "" || sink == "" {
+			return nil, fmt.Errorf("invalid sink mapping %q, expected event_type=sink", pair)
+		}
+
+		sinks[eventType] = sink
+	}
+
+	return sinks, nil
 }
 
 // getEnv retrieves the value of an environment variable or returns a default value if not set.
@@ -56,6 +107,43 @@ func Load() (*Config, error) {
 		return nil, fmt.Errorf("invalid DB_PORT: %w", err)
 	}
 
+	producerMode := getEnv("KAFKA_PRODUCER_MODE", "sync")
+
+	if producerMode != "sync" && producerMode != "async" {
+		return nil, fmt.Errorf("invalid KAFKA_PRODUCER_MODE %q, expected sync or async", producerMode)
+	}
+
+	idempotent, err := strconv.ParseBool(getEnv("KAFKA_IDEMPOTENT", "true"))
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid KAFKA_IDEMPOTENT: %w", err)
+	}
+
+	outboxSinks, err := parseSinks(getEnv("OUTBOX_SINKS", ""))
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid OUTBOX_SINKS: %w", err)
+	}
+
+	webhookTimeout, err := time.ParseDuration(getEnv("WEBHOOK_TIMEOUT", "10s"))
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid WEBHOOK_TIMEOUT: %w", err)
+	}
+
+	inboundBreakerMode := getEnv("INBOUND_BREAKER_MODE", "consecutive")
+
+	if inboundBreakerMode != "consecutive" && inboundBreakerMode != "window" {
+		return nil, fmt.Errorf("invalid INBOUND_BREAKER_MODE %q, expected consecutive or window", inboundBreakerMode)
+	}
+
+	// Identify this instance when claiming work shared with other replicas
+	hostname, err := os.Hostname()
+
+	if err != nil {
+		hostname = "unknown"
+	}
+
 	return &Config{
 		Port:     port,
 		LogLevel: getEnv("LOG_LEVEL", "info"),
@@ -72,8 +160,22 @@ func Load() (*Config, error) {
 			Brokers:      strings.Split(getEnv("KAFKA_BROKERS", "localhost:9092"), ","),
 			OrdersTopic:  getEnv("KAFKA_ORDERS_TOPIC", "orders"),
 			ConsumerGroup: getEnv("KAFKA_CONSUMER_GROUP", "orders-consumer"),
+			ProducerMode: producerMode,
+			Compression:  getEnv("KAFKA_COMPRESSION", "snappy"),
+			Idempotent:   idempotent,
+			TransactionalID: getEnv("KAFKA_TRANSACTIONAL_ID", ""),
+		},
+		Outbox: OutboxConfig{
+			DefaultSink:    getEnv("OUTBOX_DEFAULT_SINK", "kafka"),
+			Sinks:          outboxSinks,
+			WebhookURL:     getEnv("WEBHOOK_URL", ""),
+			WebhookSecret:  getEnv("WEBHOOK_SECRET", ""),
+			WebhookTimeout: webhookTimeout,
+			FilePath:       getEnv("OUTBOX_FILE_PATH", "outbox.ndjson"),
 		},
 		WarehouseURL: getEnv("WAREHOUSE_URL", "http://localhost:8081"),
+		InstanceID:   getEnv("INSTANCE_ID", fmt.Sprintf("%s-%d", hostname, os.Getpid())),
+		InboundBreakerMode: inboundBreakerMode,
 	}, nil
 }
 
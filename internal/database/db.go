@@ -7,7 +7,7 @@ import (
 
 
 	"github.com/jmoiron/sqlx"
-	_ "github.com/lib/pq" // PostgreSQL driver
+	"github.com/lib/pq" // PostgreSQL driver
 	"github.com/vaidashi/fault-tolerant-api/internal/config"
 	"github.com/vaidashi/fault-tolerant-api/pkg/logger"
 )
@@ -15,6 +15,7 @@ import (
 // Database represents a database connection
 type Database struct {
 	DB    *sqlx.DB
+	connString string
 	logger logger.Logger
 }
 
@@ -34,8 +35,9 @@ func New(cfg *config.Config, logger logger.Logger) (*Database, error) {
 	logger.Info("Connected to database", "host", cfg.DB.Host, "database", cfg.DB.Name)
 
 	return &Database{
-		DB:     db,
-		logger: logger,
+		DB:         db,
+		connString: cfg.GetDBConnString(),
+		logger:     logger,
 	}, nil
 }
 
@@ -44,6 +46,23 @@ func (d *Database) Ping(ctx context.Context) error {
 	return d.DB.PingContext(ctx)
 }
 
+// Listen opens a dedicated connection subscribed to a Postgres notification channel
+func (d *Database) Listen(channel string) (*pq.Listener, error) {
+	listener := pq.NewListener(d.connString, 1*time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			d.logger.Error("Database listener error", "error", err, "channel", channel, "event", event)
+		}
+	})
+
+	if err := listener.Listen(channel); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("failed to listen on channel %s: %w", channel, err)
+	}
+
+	d.logger.Info("Listening for database notifications", "channel", channel)
+	return listener, nil
+}
+
 // Close closes the database connection
 func (d *Database) Close() error {
 	return d.DB.Close()
@@ -64,9 +83,35 @@ func (d *Database) RunMigrations() error {
 		updated_at TIMESTAMP NOT NULL DEFAULT NOW()
 	);
 
+	-- Version for optimistic concurrency control
+	ALTER TABLE orders ADD COLUMN IF NOT EXISTS version INT NOT NULL DEFAULT 1;
+
 	CREATE INDEX IF NOT EXISTS idx_orders_customer_id ON orders(customer_id);
 	CREATE INDEX IF NOT EXISTS idx_orders_status ON orders(status);
 
+	-- Line items of each order, the order amount is their total
+	CREATE TABLE IF NOT EXISTS order_items (
+		id SERIAL PRIMARY KEY,
+		order_id VARCHAR(50) NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+		product_id VARCHAR(50) NOT NULL,
+		quantity INT NOT NULL CHECK (quantity > 0),
+		unit_price DECIMAL(10, 2) NOT NULL CHECK (unit_price >= 0)
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_order_items_order_id ON order_items(order_id);
+
+	-- Address each order is shipped to
+	CREATE TABLE IF NOT EXISTS order_shipping_addresses (
+		order_id VARCHAR(50) PRIMARY KEY REFERENCES orders(id) ON DELETE CASCADE,
+		recipient VARCHAR(255) NOT NULL,
+		line1 VARCHAR(255) NOT NULL,
+		line2 VARCHAR(255) NOT NULL DEFAULT '',
+		city VARCHAR(100) NOT NULL,
+		state VARCHAR(100) NOT NULL DEFAULT '',
+		postal_code VARCHAR(20) NOT NULL,
+		country VARCHAR(100) NOT NULL
+	);
+
 	-- Outbox table for message publishing
     CREATE TABLE IF NOT EXISTS outbox_messages (
         id SERIAL PRIMARY KEY,
@@ -84,6 +129,38 @@ func (d *Database) RunMigrations() error {
     CREATE INDEX IF NOT EXISTS idx_outbox_status ON outbox_messages(status);
     CREATE INDEX IF NOT EXISTS idx_outbox_aggregate ON outbox_messages(aggregate_type, aggregate_id);
 
+	-- Lease columns so multiple instances can claim outbox messages safely
+    ALTER TABLE outbox_messages ADD COLUMN IF NOT EXISTS locked_by VARCHAR(100);
+    ALTER TABLE outbox_messages ADD COLUMN IF NOT EXISTS locked_until TIMESTAMP;
+
+    CREATE INDEX IF NOT EXISTS idx_outbox_locked_until ON outbox_messages(locked_until) WHERE status = 'processing';
+
+	-- Scheduled retries for outbox messages that failed to publish
+    ALTER TABLE outbox_messages ADD COLUMN IF NOT EXISTS next_attempt_at TIMESTAMP;
+
+    CREATE INDEX IF NOT EXISTS idx_outbox_next_attempt ON outbox_messages(next_attempt_at) WHERE status = 'pending';
+
+	-- Archive for completed outbox messages removed by the retention worker
+    CREATE TABLE IF NOT EXISTS outbox_messages_archive (
+        id BIGINT PRIMARY KEY,
+        aggregate_type VARCHAR(50) NOT NULL,
+        aggregate_id VARCHAR(50) NOT NULL,
+        event_type VARCHAR(50) NOT NULL,
+        payload JSONB NOT NULL,
+        created_at TIMESTAMP NOT NULL,
+        processed_at TIMESTAMP,
+        processing_attempts INT NOT NULL DEFAULT 0,
+        archived_at TIMESTAMP NOT NULL DEFAULT NOW()
+    );
+
+    CREATE INDEX IF NOT EXISTS idx_outbox_archive_aggregate ON outbox_messages_archive(aggregate_type, aggregate_id);
+
+	-- Request that produced an outbox message, published as Kafka headers
+    ALTER TABLE outbox_messages ADD COLUMN IF NOT EXISTS correlation_id VARCHAR(100);
+    ALTER TABLE outbox_messages ADD COLUMN IF NOT EXISTS trace_parent VARCHAR(55);
+    ALTER TABLE outbox_messages_archive ADD COLUMN IF NOT EXISTS correlation_id VARCHAR(100);
+    ALTER TABLE outbox_messages_archive ADD COLUMN IF NOT EXISTS trace_parent VARCHAR(55);
+
 	-- Dead letter queue for failed messages
     CREATE TABLE IF NOT EXISTS dead_letter_messages (
         id SERIAL PRIMARY KEY,
@@ -93,7 +170,7 @@ func (d *Database) RunMigrations() error {
         event_type VARCHAR(50) NOT NULL,
         payload JSONB NOT NULL,
         error_message TEXT NOT NULL,
-        failure_reason VARCHAR(100) NOT NULL,
+        failure_reason TEXT NOT NULL,
         retry_count INT NOT NULL DEFAULT 0,
         last_retry_at TIMESTAMP,
         status VARCHAR(20) NOT NULL DEFAULT 'pending',
@@ -101,8 +178,48 @@ func (d *Database) RunMigrations() error {
         resolved_at TIMESTAMP
     );
 
+    -- Discard reasons are appended to the failure reason, so it can't be bounded
+    ALTER TABLE dead_letter_messages ALTER COLUMN failure_reason TYPE TEXT;
+
     CREATE INDEX IF NOT EXISTS idx_dlq_status ON dead_letter_messages(status);
     CREATE INDEX IF NOT EXISTS idx_dlq_aggregate ON dead_letter_messages(aggregate_type, aggregate_id);
+    CREATE INDEX IF NOT EXISTS idx_dlq_created_at ON dead_letter_messages(created_at DESC, id DESC);
+
+    -- Audit trail of payload corrections made to dead letters before redrive
+    CREATE TABLE IF NOT EXISTS dead_letter_edits (
+        id SERIAL PRIMARY KEY,
+        dead_letter_id BIGINT NOT NULL,
+        original_payload JSONB NOT NULL,
+        edited_payload JSONB NOT NULL,
+        edited_by VARCHAR(100) NOT NULL,
+        edited_at TIMESTAMP NOT NULL DEFAULT NOW()
+    );
+
+    CREATE INDEX IF NOT EXISTS idx_dlq_edits_dead_letter_id ON dead_letter_edits(dead_letter_id, edited_at);
+
+    -- History of dead letter state transitions and retry attempts
+    CREATE TABLE IF NOT EXISTS dead_letter_events (
+        id SERIAL PRIMARY KEY,
+        dead_letter_id BIGINT NOT NULL,
+        event VARCHAR(30) NOT NULL,
+        from_status VARCHAR(20),
+        to_status VARCHAR(20) NOT NULL,
+        actor VARCHAR(100) NOT NULL,
+        error TEXT,
+        created_at TIMESTAMP NOT NULL DEFAULT NOW()
+    );
+
+    CREATE INDEX IF NOT EXISTS idx_dlq_events_dead_letter_id ON dead_letter_events(dead_letter_id, created_at);
+
+    -- Events already applied by each consumer, used to drop redeliveries
+    CREATE TABLE IF NOT EXISTS processed_events (
+        consumer VARCHAR(100) NOT NULL,
+        event_id VARCHAR(50) NOT NULL,
+        event_type VARCHAR(50) NOT NULL,
+        aggregate_id VARCHAR(50) NOT NULL,
+        processed_at TIMESTAMP NOT NULL DEFAULT NOW(),
+        PRIMARY KEY (consumer, event_id)
+    );
 
 	-- Shipments table for tracking order shipments
     CREATE TABLE IF NOT EXISTS shipments (
@@ -117,6 +234,41 @@ func (d *Database) RunMigrations() error {
 
     CREATE INDEX IF NOT EXISTS idx_shipments_order_id ON shipments(order_id);
     CREATE INDEX IF NOT EXISTS idx_shipments_status ON shipments(status);
+    -- Orders may already have duplicate shipments, keep the most advanced one
+    -- per order and fail the rest so the unique index below can be built
+    UPDATE shipments SET status = 'failed', updated_at = NOW()
+    WHERE id IN (
+        SELECT id FROM (
+            SELECT id, ROW_NUMBER() OVER (
+                PARTITION BY order_id
+                ORDER BY CASE status WHEN 'delivered' THEN 0 WHEN 'shipped' THEN 1 ELSE 2 END, created_at, id
+            ) AS rank
+            FROM shipments
+            WHERE status <> 'failed'
+        ) ranked
+        WHERE rank > 1
+    );
+
+    -- At most one shipment per order, a new one can only be created after it failed
+    CREATE UNIQUE INDEX IF NOT EXISTS idx_shipments_order_active ON shipments(order_id) WHERE status <> 'failed';
+
+    -- Idempotency keys sent by clients, with the response to replay on retries
+    CREATE TABLE IF NOT EXISTS idempotency_keys (
+        key VARCHAR(255) PRIMARY KEY,
+        request_method VARCHAR(10) NOT NULL,
+        request_path TEXT NOT NULL,
+        request_hash VARCHAR(64) NOT NULL,
+        response_status INT,
+        response_body BYTEA,
+        locked_at TIMESTAMP NOT NULL DEFAULT NOW(),
+        created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+        completed_at TIMESTAMP
+    );
+
+    CREATE INDEX IF NOT EXISTS idx_idempotency_keys_created_at ON idempotency_keys(created_at);
+
+    -- Headers such as ETag and Location replayed along with the stored response
+    ALTER TABLE idempotency_keys ADD COLUMN IF NOT EXISTS response_headers JSONB;
 	`
 
 	_, err := d.DB.Exec(schema)
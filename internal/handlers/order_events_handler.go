@@ -2,33 +2,61 @@ package handlers
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
 	"encoding/json"
 
 	"github.com/Shopify/sarama"
 	"github.com/vaidashi/fault-tolerant-api/pkg/logger"
 	"github.com/vaidashi/fault-tolerant-api/internal/models"
+	"github.com/vaidashi/fault-tolerant-api/internal/repository"
+	"github.com/vaidashi/fault-tolerant-api/pkg/kafka"
+	"github.com/vaidashi/fault-tolerant-api/pkg/tracing"
+	apperrors "github.com/vaidashi/fault-tolerant-api/pkg/errors"
 )
 
+// OrderEventsConsumer identifies this handler in the processed events store
+const OrderEventsConsumer = "order-events"
+
+// handledEventTypes lists the event types applied by OrderEventsHandler
+var handledEventTypes = map[string]bool{
+	"order_created":        true,
+	"order_updated":        true,
+	"order_status_changed": true,
+}
+
 // OrderEventsHandler handles order events from Kafka
 type OrderEventsHandler struct {
+	processedRepo *repository.ProcessedEventRepository
 	logger logger.Logger
 }
 
 // NewOrderEventsHandler creates a new OrderEventsHandler
-func NewOrderEventsHandler(logger logger.Logger) *OrderEventsHandler {
+func NewOrderEventsHandler(processedRepo *repository.ProcessedEventRepository, logger logger.Logger) *OrderEventsHandler {
 	return &OrderEventsHandler{
+		processedRepo: processedRepo,
 		logger: logger,
 	}
 }
 
 // HandleMessage handles incoming order events from Kafka messages
 func (h *OrderEventsHandler) HandleMessage(ctx context.Context, msg *sarama.ConsumerMessage) error {
+	// Skip events we don't handle without deserializing them
+	if eventType := kafka.Metadata(msg).EventType; eventType != "" && !handledEventTypes[eventType] {
+		h.logger.Debug("Ignoring unhandled event type", "eventType", eventType)
+		return nil
+	}
+
 	var event models.OutboxMessageEvent
 	
 	if err := json.Unmarshal(msg.Value, &event); err != nil {
 		h.logger.Error("failed to unmarshal message", "error", err)
-		return fmt.Errorf("failed to unmarshal message: %w", err)
+		// Send malformed records straight to the dead letter topic
+		return fmt.Errorf("%w: failed to unmarshal message: %v", apperrors.ErrPermanentFailure, err)
+	}
+
+	if event.EventID == "" {
+		return fmt.Errorf("%w: event has no event_id", apperrors.ErrPermanentFailure)
 	}
 
 	h.logger.Info("Handling order event",
@@ -36,24 +64,68 @@ func (h *OrderEventsHandler) HandleMessage(ctx context.Context, msg *sarama.Cons
 		"eventId", event.EventID,
 		"aggregateId", event.AggregateID,
 		"occurredAt", event.OccurredAt,
+		"correlationId", tracing.CorrelationID(ctx),
+		"traceParent", tracing.TraceParent(ctx),
 	)
 
+	// Record the event in the same transaction as its effects, so a redelivery
+	// either sees it as processed or the first attempt left nothing behind
+	tx, err := h.processedRepo.BeginTx(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	// Rollback transaction if any error occurs
+	defer func() {
+		if err != nil {
+			if rollbackErr := tx.Rollback(); rollbackErr != nil {
+				h.logger.Error("Failed to rollback transaction", "error", rollbackErr)
+			}
+		}
+	}()
+
+	first, err := h.processedRepo.MarkProcessedInTx(tx, OrderEventsConsumer, &event)
+
+	if err != nil {
+		return fmt.Errorf("failed to record processed event: %w", err)
+	}
+
+	if !first {
+		h.logger.Info("Skipping already processed event",
+			"eventType", event.EventType,
+			"eventId", event.EventID,
+			"aggregateId", event.AggregateID)
+		return tx.Rollback()
+	}
+
 	// Handle different event types
 	switch event.EventType {
 	case "order_created":
-		return h.handleOrderCreated(event)
+		err = h.handleOrderCreated(tx, event)
 	case "order_updated":
-		return h.handleOrderUpdated(event)
+		err = h.handleOrderUpdated(tx, event)
 	case "order_status_changed":
-		return h.handleOrderStatusChanged(event)
+		err = h.handleOrderStatusChanged(tx, event)
 	default:
 		h.logger.Warn("unknown event type", "eventType", event.EventType)
-		return nil
 	}
+
+	if err != nil {
+		return err
+	}
+
+	// Commit transaction
+	if err = tx.Commit(); err != nil {
+		h.logger.Error("Failed to commit transaction", "error", err)
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
 }
 
 // handleOrderCreated handles the order_created event
-func (h *OrderEventsHandler) handleOrderCreated(event models.OutboxMessageEvent) error {
+func (h *OrderEventsHandler) handleOrderCreated(tx *sql.Tx, event models.OutboxMessageEvent) error {
     h.logger.Info("Processing order created event", 
         "orderID", event.AggregateID, 
         "eventID", event.EventID,
@@ -62,13 +134,13 @@ func (h *OrderEventsHandler) handleOrderCreated(event models.OutboxMessageEvent)
     // In a real application, you would:
     // 1. Extract the order data from event.Data
     // 2. Process the new order (e.g., send confirmation email, notify warehouse, etc.)
-    // 3. Update any relevant systems
+    // 3. Update any relevant systems, writing through tx so the effects are applied once
     
     return nil
 }
 
 // handleOrderUpdated handles the order_updated event
-func (h *OrderEventsHandler) handleOrderUpdated(event models.OutboxMessageEvent) error {
+func (h *OrderEventsHandler) handleOrderUpdated(tx *sql.Tx, event models.OutboxMessageEvent) error {
     h.logger.Info("Processing order updated event", 
         "orderID", event.AggregateID, 
         "eventID", event.EventID)
@@ -82,7 +154,7 @@ func (h *OrderEventsHandler) handleOrderUpdated(event models.OutboxMessageEvent)
 }
 
 // handleOrderStatusChanged handles the order_status_changed event
-func (h *OrderEventsHandler) handleOrderStatusChanged(event models.OutboxMessageEvent) error {
+func (h *OrderEventsHandler) handleOrderStatusChanged(tx *sql.Tx, event models.OutboxMessageEvent) error {
     h.logger.Info("Processing order status changed event", 
         "orderID", event.AggregateID, 
         "eventID", event.EventID)
@@ -92,7 +164,7 @@ func (h *OrderEventsHandler) handleOrderStatusChanged(event models.OutboxMessage
 	
     if !ok {
         h.logger.Error("Invalid event data format", "eventID", event.EventID)
-        return fmt.Errorf("invalid event data format")
+        return fmt.Errorf("%w: invalid event data format", apperrors.ErrPermanentFailure)
     }
     
     oldStatus, _ := data["old_status"].(string)
@@ -13,6 +13,32 @@ const (
 	DeadLetterStatusDiscarded DeadLetterStatus = "discarded"
 )
 
+// DeadLetterEventType identifies an entry in a dead letter's history
+type DeadLetterEventType string
+const (
+	DeadLetterEventCreated     DeadLetterEventType = "created"
+	DeadLetterEventRetrying    DeadLetterEventType = "retrying"
+	DeadLetterEventRetryFailed DeadLetterEventType = "retry_failed"
+	DeadLetterEventResolved    DeadLetterEventType = "resolved"
+	DeadLetterEventDiscarded   DeadLetterEventType = "discarded"
+	DeadLetterEventReset       DeadLetterEventType = "reset"
+	DeadLetterEventEdited      DeadLetterEventType = "edited"
+)
+
+// Actors recorded in the dead letter history
+const (
+	DeadLetterActorOutboxProcessor = "outbox-processor"
+	DeadLetterActorDLQProcessor    = "dead-letter-processor"
+	DeadLetterActorAdminAPI        = "admin-api"
+)
+
+// Failure reasons recorded when a message is sent to the dead letter queue
+const (
+	FailureReasonNoHandler    = "No handler available"
+	FailureReasonMaxRetries   = "Max retries exceeded"
+	FailureReasonNonRetryable = "Non-retryable error"
+)
+
 // DeadLetterMessage represents a message in the dead-letter queue
 type DeadLetterMessage struct {
 	ID                 int64          `db:"id" json:"id"`
@@ -44,4 +70,25 @@ func NewDeadLetterMessage(outboxMsg *OutboxMessage, errorMsg string, reason stri
 		Status:            string(DeadLetterStatusPending),
 		CreatedAt:         time.Now().UTC(),
 	}
-}
\ No newline at end of file
+}
+// DeadLetterEvent records a state transition or retry attempt of a dead letter message
+type DeadLetterEvent struct {
+	ID           int64     `db:"id" json:"id"`
+	DeadLetterID int64     `db:"dead_letter_id" json:"dead_letter_id"`
+	Event        string    `db:"event" json:"event"`
+	FromStatus   *string   `db:"from_status" json:"from_status,omitempty"`
+	ToStatus     string    `db:"to_status" json:"to_status"`
+	Actor        string    `db:"actor" json:"actor"`
+	Error        *string   `db:"error" json:"error,omitempty"`
+	CreatedAt    time.Time `db:"created_at" json:"created_at"`
+}
+
+// DeadLetterEdit records a payload correction made to a dead letter message
+type DeadLetterEdit struct {
+	ID              int64     `db:"id" json:"id"`
+	DeadLetterID    int64     `db:"dead_letter_id" json:"dead_letter_id"`
+	OriginalPayload []byte    `db:"original_payload" json:"original_payload"`
+	EditedPayload   []byte    `db:"edited_payload" json:"edited_payload"`
+	EditedBy        string    `db:"edited_by" json:"edited_by"`
+	EditedAt        time.Time `db:"edited_at" json:"edited_at"`
+}
@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+)
+
+// IdempotencyKey records a request made with an Idempotency-Key header and,
+// once it finished, the response to replay when the request is retried
+type IdempotencyKey struct {
+	Key             string     `db:"key" json:"key"`
+	RequestMethod   string     `db:"request_method" json:"request_method"`
+	RequestPath     string     `db:"request_path" json:"request_path"`
+	RequestHash     string     `db:"request_hash" json:"request_hash"`
+	ResponseStatus  *int       `db:"response_status" json:"response_status,omitempty"`
+	ResponseBody    []byte     `db:"response_body" json:"-"`
+	ResponseHeaders []byte     `db:"response_headers" json:"-"` // JSON object of the replayed headers
+	LockedAt        time.Time  `db:"locked_at" json:"locked_at"`
+	CreatedAt       time.Time  `db:"created_at" json:"created_at"`
+	CompletedAt     *time.Time `db:"completed_at" json:"completed_at,omitempty"`
+}
+
+// Completed reports whether the original request finished and its response was stored
+func (k *IdempotencyKey) Completed() bool {
+	return k.ResponseStatus != nil
+}
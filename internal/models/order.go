@@ -1,6 +1,10 @@
 package models
 
 import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
 	"time"
 )
 
@@ -11,8 +15,114 @@ type Order struct {
 	Amount      float64   `db:"amount" json:"amount"`
 	Status      string    `db:"status" json:"status"`
 	Description string    `db:"description" json:"description,omitempty"`
+	Version     int       `db:"version" json:"version"` // Incremented on every update
 	CreatedAt   time.Time `db:"created_at" json:"created_at"`
 	UpdatedAt   time.Time `db:"updated_at" json:"updated_at"`
+	Items           []OrderItem      `db:"-" json:"items,omitempty"`
+	ShippingAddress *ShippingAddress `db:"-" json:"shipping_address,omitempty"`
+}
+
+// OrderItem is a line item of an order
+type OrderItem struct {
+	ID        int64   `db:"id" json:"id,omitempty"`
+	OrderID   string  `db:"order_id" json:"-"`
+	ProductID string  `db:"product_id" json:"product_id"`
+	Quantity  int     `db:"quantity" json:"quantity"`
+	UnitPrice float64 `db:"unit_price" json:"unit_price"`
+}
+
+// ShippingAddress is the address an order is shipped to
+type ShippingAddress struct {
+	OrderID    string `db:"order_id" json:"-"`
+	Recipient  string `db:"recipient" json:"recipient"`
+	Line1      string `db:"line1" json:"line1"`
+	Line2      string `db:"line2" json:"line2,omitempty"`
+	City       string `db:"city" json:"city"`
+	State      string `db:"state" json:"state,omitempty"`
+	PostalCode string `db:"postal_code" json:"postal_code"`
+	Country    string `db:"country" json:"country"`
+}
+
+// ErrInvalidOrder is returned when an order's items or shipping address are invalid
+var ErrInvalidOrder = errors.New("invalid order")
+
+// ValidateOrderItems checks that an order has at least one well-formed line item
+func ValidateOrderItems(items []OrderItem) error {
+	if len(items) == 0 {
+		return fmt.Errorf("%w: at least one item is required", ErrInvalidOrder)
+	}
+
+	for i, item := range items {
+		if strings.TrimSpace(item.ProductID) == "" {
+			return fmt.Errorf("%w: item %d: product_id is required", ErrInvalidOrder, i)
+		}
+
+		if item.Quantity <= 0 {
+			return fmt.Errorf("%w: item %d: quantity must be greater than zero", ErrInvalidOrder, i)
+		}
+
+		if item.UnitPrice < 0 || math.IsNaN(item.UnitPrice) || math.IsInf(item.UnitPrice, 0) {
+			return fmt.Errorf("%w: item %d: unit_price must not be negative", ErrInvalidOrder, i)
+		}
+	}
+
+	if OrderItemsTotal(items) <= 0 {
+		return fmt.Errorf("%w: order total must be greater than zero", ErrInvalidOrder)
+	}
+
+	return nil
+}
+
+// OrderItemsTotal computes the order amount from its items, in cents to avoid
+// accumulating floating point errors
+func OrderItemsTotal(items []OrderItem) float64 {
+	var cents int64
+
+	for _, item := range items {
+		cents += int64(math.Round(item.UnitPrice*100)) * int64(item.Quantity)
+	}
+
+	return float64(cents) / 100
+}
+
+// Validate checks that the address has the fields needed to ship an order
+func (a *ShippingAddress) Validate() error {
+	if a == nil {
+		return fmt.Errorf("%w: shipping_address is required", ErrInvalidOrder)
+	}
+
+	required := []struct {
+		name  string
+		value string
+	}{
+		{"recipient", a.Recipient},
+		{"line1", a.Line1},
+		{"city", a.City},
+		{"postal_code", a.PostalCode},
+		{"country", a.Country},
+	}
+
+	for _, field := range required {
+		if strings.TrimSpace(field.value) == "" {
+			return fmt.Errorf("%w: shipping_address.%s is required", ErrInvalidOrder, field.name)
+		}
+	}
+
+	return nil
+}
+
+// String formats the address on a single line
+func (a *ShippingAddress) String() string {
+	parts := []string{a.Recipient, a.Line1, a.Line2, a.City, strings.TrimSpace(a.State + " " + a.PostalCode), a.Country}
+	nonEmpty := parts[:0]
+
+	for _, part := range parts {
+		if part != "" {
+			nonEmpty = append(nonEmpty, part)
+		}
+	}
+
+	return strings.Join(nonEmpty, ", ")
 }
 
 // OrderStatus represents the status of an order
@@ -26,17 +136,73 @@ const (
 	OrderStatusCancelled  OrderStatus = "cancelled"
 )
 
-// NewOrder creates a new order
-func NewOrder(customerID string, amount float64, description string) *Order {
+// NewOrder creates a new order for the given items, its amount is the items' total
+func NewOrder(customerID string, items []OrderItem, address *ShippingAddress, description string) *Order {
 	now := time.Now()
+	id := GenerateID("ord")
+
+	orderItems := make([]OrderItem, len(items))
+
+	for i, item := range items {
+		item.OrderID = id
+		orderItems[i] = item
+	}
+
+	shippingAddress := *address
+	shippingAddress.OrderID = id
 
 	return &Order{
-		ID:          GenerateID("ord"),
+		ID:          id,
 		CustomerID:  customerID,
-		Amount:      amount,
+		Amount:      OrderItemsTotal(items),
 		Status:      string(OrderStatusPending),
 		Description: description,
+		Version:     1,
 		CreatedAt:   now,
 		UpdatedAt:   now,
+		Items:           orderItems,
+		ShippingAddress: &shippingAddress,
 	}
-}
\ No newline at end of file
+}
+// OrderStatuses lists every order status in lifecycle order
+var OrderStatuses = []OrderStatus{
+	OrderStatusPending,
+	OrderStatusApproved,
+	OrderStatusRejected,
+	OrderStatusShipped,
+	OrderStatusDelivered,
+	OrderStatusCancelled,
+}
+
+// OrderTransitions maps each order status to the statuses it may move to,
+// statuses without outgoing transitions are terminal
+var OrderTransitions = map[OrderStatus][]OrderStatus{
+	OrderStatusPending:   {OrderStatusApproved, OrderStatusRejected, OrderStatusCancelled},
+	OrderStatusApproved:  {OrderStatusShipped, OrderStatusCancelled},
+	OrderStatusShipped:   {OrderStatusDelivered},
+	OrderStatusRejected:  {},
+	OrderStatusDelivered: {},
+	OrderStatusCancelled: {},
+}
+
+// IsValid reports whether the status is a known order status
+func (s OrderStatus) IsValid() bool {
+	_, ok := OrderTransitions[s]
+	return ok
+}
+
+// IsTerminal reports whether an order in this status can no longer change
+func (s OrderStatus) IsTerminal() bool {
+	return len(OrderTransitions[s]) == 0
+}
+
+// CanTransitionTo reports whether an order may move from this status to next
+func (s OrderStatus) CanTransitionTo(next OrderStatus) bool {
+	for _, allowed := range OrderTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+
+	return false
+}
@@ -1,8 +1,12 @@
 package models 
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"time"
+
+	"github.com/vaidashi/fault-tolerant-api/pkg/tracing"
 )
 
 // OutboxStatus represents the status of an outbox message
@@ -26,6 +30,26 @@ type OutboxMessage struct {
 	ProcessingAttempts int        `db:"processing_attempts" json:"processing_attempts"`
 	LastError         *string     `db:"last_error" json:"last_error,omitempty"`
 	Status            OutboxStatus `db:"status" json:"status"`
+	LockedBy          *string     `db:"locked_by" json:"locked_by,omitempty"`
+	LockedUntil       *time.Time  `db:"locked_until" json:"locked_until,omitempty"`
+	NextAttemptAt     *time.Time  `db:"next_attempt_at" json:"next_attempt_at,omitempty"`
+	CorrelationID     *string     `db:"correlation_id" json:"correlation_id,omitempty"`
+	TraceParent       *string     `db:"trace_parent" json:"trace_parent,omitempty"`
+}
+
+// EventSchemaVersion is the version of the OutboxMessageEvent envelope
+const EventSchemaVersion = "1"
+
+// SetTraceContext records the correlation ID and trace context of the request
+// that produced the message
+func (m *OutboxMessage) SetTraceContext(ctx context.Context) {
+	if correlationID := tracing.CorrelationID(ctx); correlationID != "" {
+		m.CorrelationID = &correlationID
+	}
+
+	if traceParent := tracing.TraceParent(ctx); traceParent != "" {
+		m.TraceParent = &traceParent
+	}
 }
 
 // OutboxMessageEvent represents the event data in the outbox message
@@ -35,6 +59,40 @@ type OutboxMessageEvent struct {
 	AggregateID string          `json:"aggregate_id"`
 	OccurredAt time.Time     `json:"occurred_at"`
 	Data interface{} `json:"data"`
+	// ReplayOf holds the ID of the original event when the event is a replay
+	ReplayOf string `json:"replay_of,omitempty"`
+}
+
+// ValidateEventPayload checks that a payload is a well-formed OutboxMessageEvent
+// of the given event type and aggregate
+func ValidateEventPayload(payload []byte, eventType, aggregateID string) error {
+	var event OutboxMessageEvent
+
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return fmt.Errorf("payload is not a valid event: %v", err)
+	}
+
+	if event.EventType != eventType {
+		return fmt.Errorf("event_type must be %q", eventType)
+	}
+
+	if event.EventID == "" {
+		return fmt.Errorf("event_id is required")
+	}
+
+	if event.AggregateID != aggregateID {
+		return fmt.Errorf("aggregate_id must be %q", aggregateID)
+	}
+
+	if event.OccurredAt.IsZero() {
+		return fmt.Errorf("occurred_at is required")
+	}
+
+	if event.Data == nil {
+		return fmt.Errorf("data is required")
+	}
+
+	return nil
 }
 
 // NewOrderCreatedEvent creates a new order created event
@@ -103,6 +161,7 @@ func NewOrderStatusChangedEvent(order *Order, oldStatus string) (*OutboxMessage,
 			"new_status": order.Status,
 			"order_id": order.ID,
 			"customer_id": order.CustomerID,
+			"version": order.Version,
 		},
 	}
 
@@ -0,0 +1,352 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/vaidashi/fault-tolerant-api/internal/models"
+	"github.com/vaidashi/fault-tolerant-api/internal/repository"
+	"github.com/vaidashi/fault-tolerant-api/pkg/logger"
+)
+
+// DeadLetterJobAction is the operation a bulk job applies to dead letters
+type DeadLetterJobAction string
+
+const (
+	DeadLetterJobRetry   DeadLetterJobAction = "retry"
+	DeadLetterJobDiscard DeadLetterJobAction = "discard"
+)
+
+// DeadLetterJobStatus represents the status of a bulk job
+type DeadLetterJobStatus string
+
+const (
+	DeadLetterJobRunning   DeadLetterJobStatus = "running"
+	DeadLetterJobCompleted DeadLetterJobStatus = "completed"
+	DeadLetterJobFailed    DeadLetterJobStatus = "failed"
+	DeadLetterJobCancelled DeadLetterJobStatus = "cancelled"
+)
+
+const (
+	// maxDryRunSamples caps the number of message IDs reported by a dry run
+	maxDryRunSamples = 100
+	// finishedJobTTL is how long a finished job stays available for status requests
+	finishedJobTTL = 24 * time.Hour
+	// maxFinishedJobs caps the number of finished jobs kept in memory
+	maxFinishedJobs = 100
+)
+
+// ErrJobNotFound is returned when a bulk job does not exist
+var ErrJobNotFound = errors.New("dead letter job not found")
+
+// DeadLetterJob tracks the progress of a bulk dead letter operation
+type DeadLetterJob struct {
+	ID         string                      `json:"id"`
+	Action     DeadLetterJobAction         `json:"action"`
+	DryRun     bool                        `json:"dry_run"`
+	Reason     string                      `json:"reason,omitempty"`
+	Filter     repository.DeadLetterFilter `json:"filter"`
+	Status     DeadLetterJobStatus         `json:"status"`
+	Total      int                         `json:"total"`
+	Processed  int                         `json:"processed"`
+	Succeeded  int                         `json:"succeeded"`
+	Failed     int                         `json:"failed"`
+	Skipped    int                         `json:"skipped"`
+	MessageIDs []int64                     `json:"message_ids,omitempty"` // Matching IDs, for dry runs
+	Error      string                      `json:"error,omitempty"`
+	StartedAt  time.Time                   `json:"started_at"`
+	FinishedAt *time.Time                  `json:"finished_at,omitempty"`
+	cancel     context.CancelFunc
+}
+
+// DeadLetterJobManager runs and tracks bulk dead letter jobs in the background
+type DeadLetterJobManager struct {
+	dlqRepo   *repository.DeadLetterRepository
+	processor *DeadLetterProcessor
+	batchSize int
+	logger    logger.Logger
+	jobs      map[string]*DeadLetterJob
+	ctx       context.Context
+	cancel    context.CancelFunc
+	wg        sync.WaitGroup
+	mu        sync.RWMutex
+}
+
+// NewDeadLetterJobManager creates a new DeadLetterJobManager
+func NewDeadLetterJobManager(
+	dlqRepo *repository.DeadLetterRepository,
+	processor *DeadLetterProcessor,
+	batchSize int,
+	logger logger.Logger,
+) *DeadLetterJobManager {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	if batchSize <= 0 {
+		batchSize = 50
+	}
+
+	return &DeadLetterJobManager{
+		dlqRepo:   dlqRepo,
+		processor: processor,
+		batchSize: batchSize,
+		logger:    logger,
+		jobs:      make(map[string]*DeadLetterJob),
+		ctx:       ctx,
+		cancel:    cancel,
+	}
+}
+
+// StartJob starts a bulk job over the pending dead letters matching the filter
+func (m *DeadLetterJobManager) StartJob(
+	action DeadLetterJobAction,
+	filter repository.DeadLetterFilter,
+	reason string,
+	dryRun bool,
+) (*DeadLetterJob, error) {
+	// Only pending messages can be retried or discarded
+	filter.Status = string(models.DeadLetterStatusPending)
+
+	total, err := m.dlqRepo.Count(m.ctx, &filter)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to count matching dead letters: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(m.ctx)
+
+	job := &DeadLetterJob{
+		ID:        models.GenerateID("job"),
+		Action:    action,
+		DryRun:    dryRun,
+		Reason:    reason,
+		Filter:    filter,
+		Status:    DeadLetterJobRunning,
+		Total:     total,
+		StartedAt: time.Now().UTC(),
+		cancel:    cancel,
+	}
+
+	m.mu.Lock()
+	m.pruneJobs(job.StartedAt)
+	m.jobs[job.ID] = job
+	m.mu.Unlock()
+
+	m.wg.Add(1)
+
+	go func() {
+		defer m.wg.Done()
+		defer cancel()
+		m.runJob(ctx, job)
+	}()
+
+	m.logger.Info("Dead letter job started",
+		"jobID", job.ID,
+		"action", action,
+		"dryRun", dryRun,
+		"total", total)
+
+	return m.snapshot(job), nil
+}
+
+// runJob walks the matching dead letters page by page and applies the action
+func (m *DeadLetterJobManager) runJob(ctx context.Context, job *DeadLetterJob) {
+	var cursor *repository.Cursor
+
+	for {
+		if ctx.Err() != nil {
+			m.finishJob(job, DeadLetterJobCancelled, nil)
+			return
+		}
+
+		messages, next, err := m.dlqRepo.List(ctx, &job.Filter, cursor, m.batchSize)
+
+		if err != nil {
+			m.finishJob(job, DeadLetterJobFailed, err)
+			return
+		}
+
+		for _, msg := range messages {
+			if ctx.Err() != nil {
+				break
+			}
+			m.applyAction(ctx, job, msg)
+		}
+
+		if next == nil {
+			break
+		}
+		cursor = next
+	}
+
+	if ctx.Err() != nil {
+		m.finishJob(job, DeadLetterJobCancelled, nil)
+		return
+	}
+
+	m.finishJob(job, DeadLetterJobCompleted, nil)
+}
+
+// applyAction applies the job's action to a single dead letter and records the outcome
+func (m *DeadLetterJobManager) applyAction(ctx context.Context, job *DeadLetterJob, msg *models.DeadLetterMessage) {
+	var err error
+
+	if !job.DryRun {
+		switch job.Action {
+		case DeadLetterJobRetry:
+			err = m.processor.Redrive(ctx, msg, models.DeadLetterActorAdminAPI)
+		case DeadLetterJobDiscard:
+			err = m.dlqRepo.MarkAsDiscarded(ctx, msg.ID, job.Reason, models.DeadLetterActorAdminAPI)
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job.Processed++
+
+	switch {
+	case job.DryRun:
+		job.Succeeded++
+		if len(job.MessageIDs) < maxDryRunSamples {
+			job.MessageIDs = append(job.MessageIDs, msg.ID)
+		}
+	case errors.Is(err, ErrDeadLetterNotPending):
+		job.Skipped++
+	case err != nil:
+		job.Failed++
+		m.logger.Error("Dead letter job failed to process message",
+			"error", err,
+			"jobID", job.ID,
+			"messageID", msg.ID)
+	default:
+		job.Succeeded++
+	}
+}
+
+// finishJob records the final status of a job
+func (m *DeadLetterJobManager) finishJob(job *DeadLetterJob, status DeadLetterJobStatus, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now().UTC()
+	job.Status = status
+	job.FinishedAt = &now
+
+	if err != nil {
+		job.Error = err.Error()
+	}
+
+	m.pruneJobs(now)
+
+	m.logger.Info("Dead letter job finished",
+		"jobID", job.ID,
+		"status", status,
+		"processed", job.Processed,
+		"succeeded", job.Succeeded,
+		"failed", job.Failed,
+		"skipped", job.Skipped)
+}
+
+// pruneJobs forgets finished jobs older than finishedJobTTL and the oldest ones beyond
+// maxFinishedJobs so the job list doesn't grow for the life of the process, the caller
+// must hold the lock
+func (m *DeadLetterJobManager) pruneJobs(now time.Time) {
+	finished := make([]*DeadLetterJob, 0, len(m.jobs))
+
+	for id, job := range m.jobs {
+		if job.FinishedAt == nil {
+			continue
+		}
+
+		if now.Sub(*job.FinishedAt) > finishedJobTTL {
+			delete(m.jobs, id)
+			continue
+		}
+
+		finished = append(finished, job)
+	}
+
+	if len(finished) <= maxFinishedJobs {
+		return
+	}
+
+	sort.Slice(finished, func(i, j int) bool {
+		return finished[i].FinishedAt.Before(*finished[j].FinishedAt)
+	})
+
+	for _, job := range finished[:len(finished)-maxFinishedJobs] {
+		delete(m.jobs, job.ID)
+	}
+}
+
+// GetJob returns the current progress of a job
+func (m *DeadLetterJobManager) GetJob(id string) (*DeadLetterJob, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	job, exists := m.jobs[id]
+
+	if !exists {
+		return nil, ErrJobNotFound
+	}
+
+	return m.copyJob(job), nil
+}
+
+// ListJobs returns all jobs, most recent first
+func (m *DeadLetterJobManager) ListJobs() []*DeadLetterJob {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	jobs := make([]*DeadLetterJob, 0, len(m.jobs))
+
+	for _, job := range m.jobs {
+		jobs = append(jobs, m.copyJob(job))
+	}
+
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].StartedAt.After(jobs[j].StartedAt)
+	})
+
+	return jobs
+}
+
+// CancelJob stops a running job after the message it is currently processing
+func (m *DeadLetterJobManager) CancelJob(id string) error {
+	m.mu.RLock()
+	job, exists := m.jobs[id]
+	m.mu.RUnlock()
+
+	if !exists {
+		return ErrJobNotFound
+	}
+
+	job.cancel()
+	return nil
+}
+
+// Stop cancels all running jobs and waits for them to finish
+func (m *DeadLetterJobManager) Stop() {
+	m.cancel()
+	m.wg.Wait()
+}
+
+// snapshot returns a copy of the job that is safe to hand out
+func (m *DeadLetterJobManager) snapshot(job *DeadLetterJob) *DeadLetterJob {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.copyJob(job)
+}
+
+// copyJob copies a job, the caller must hold the lock
+func (m *DeadLetterJobManager) copyJob(job *DeadLetterJob) *DeadLetterJob {
+	jobCopy := *job
+	jobCopy.MessageIDs = append([]int64(nil), job.MessageIDs...)
+	jobCopy.cancel = nil
+	return &jobCopy
+}
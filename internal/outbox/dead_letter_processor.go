@@ -2,6 +2,7 @@ package outbox
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sync"
 	"time"
@@ -12,6 +13,10 @@ import (
 	"github.com/vaidashi/fault-tolerant-api/pkg/retry"
 )
 
+// ErrDeadLetterNotPending is returned when a dead letter was taken by another worker
+// or is no longer pending
+var ErrDeadLetterNotPending = errors.New("dead letter message is not pending")
+
 // DeadLetterProcessor processes dead letter messages
 type DeadLetterProcessor struct {
 	dlqRepo         *repository.DeadLetterRepository
@@ -21,6 +26,7 @@ type DeadLetterProcessor struct {
 	batchSize       int
 	maxRetries      int
 	backoffStrategy retry.BackoffStrategy
+	isRetryable     retry.ErrorClassifier
 	logger          logger.Logger
 	ctx             context.Context
 	cancel          context.CancelFunc
@@ -35,6 +41,7 @@ type DeadLetterProcessorConfig struct {
 	BatchSize       int
 	MaxRetries      int
 	BackoffStrategy retry.BackoffStrategy
+	ErrorClassifier retry.ErrorClassifier // Decides which handler errors are retried, defaults to retry.RetryUnlessPermanent
 }
 
 // NewDeadLetterProcessor creates a new dead letter processor
@@ -52,6 +59,12 @@ func NewDeadLetterProcessor(
 	if backoffStrategy == nil {
 		backoffStrategy = retry.NewDefaultExponentialBackoff()
 	}
+
+	isRetryable := config.ErrorClassifier
+
+	if isRetryable == nil {
+		isRetryable = retry.RetryUnlessPermanent
+	}
 	
 	return &DeadLetterProcessor{
 		dlqRepo:         dlqRepo,
@@ -61,6 +74,7 @@ func NewDeadLetterProcessor(
 		batchSize:       config.BatchSize,
 		maxRetries:      config.MaxRetries,
 		backoffStrategy: backoffStrategy,
+		isRetryable:     isRetryable,
 		logger:          logger,
 		ctx:             ctx,
 		cancel:          cancel,
@@ -134,7 +148,11 @@ func (p *DeadLetterProcessor) processBatch() error {
 	ctx, cancel := context.WithTimeout(p.ctx, p.pollingInterval)
 	defer cancel()
 
-	messages, err := p.dlqRepo.GetPendingMessages(ctx, p.batchSize)
+	// Retrying these fails the same way again, they wait for an operator to fix
+	// the payload or register a handler and redrive them
+	messages, err := p.dlqRepo.GetPendingMessages(ctx, p.batchSize,
+		models.FailureReasonNonRetryable,
+		models.FailureReasonNoHandler)
 
 	if err != nil {
 		return fmt.Errorf("failed to get pending messages: %w", err)
@@ -148,7 +166,7 @@ func (p *DeadLetterProcessor) processBatch() error {
 	p.logger.Info("Processing batch of dead letter messages", "count", len(messages))
 
 	for _, msg := range messages {
-		if err := p.processMessage(ctx, msg); err != nil {
+		if err := p.processMessage(ctx, msg, models.DeadLetterActorDLQProcessor); err != nil {
 			p.logger.Error("Failed to process dead letter message", 
 				"error", err,
 				"messageID", msg.ID, 
@@ -163,19 +181,30 @@ func (p *DeadLetterProcessor) processBatch() error {
 	return nil
 }
 
-// processMessage processes a single dead letter message
-func (p *DeadLetterProcessor) processMessage(ctx context.Context, msg *models.DeadLetterMessage) error {
-	if err := p.dlqRepo.MarkAsRetrying(ctx, msg.ID); err != nil {
+// Redrive retries a single pending dead letter message immediately on behalf of actor
+func (p *DeadLetterProcessor) Redrive(ctx context.Context, msg *models.DeadLetterMessage, actor string) error {
+	return p.processMessage(ctx, msg, actor)
+}
+
+// processMessage processes a single dead letter message, recording actor in its history
+func (p *DeadLetterProcessor) processMessage(ctx context.Context, msg *models.DeadLetterMessage, actor string) error {
+	claimed, err := p.dlqRepo.ClaimForRetry(ctx, msg.ID, actor)
+
+	if err != nil {
 		return fmt.Errorf("failed to mark message as retrying: %w", err)
 	}
 
+	if !claimed {
+		return ErrDeadLetterNotPending
+	}
+
 	handler, exists := p.handlers[msg.EventType]
 
 	if !exists {
 		errorMsg := fmt.Sprintf("no handler registered for event type %s", msg.EventType)
 		p.logger.Error(errorMsg, "messageID", msg.ID)
 
-		if err := p.dlqRepo.MarkAsDiscarded(ctx, msg.ID, "No handler available"); err != nil {
+		if err := p.dlqRepo.MarkAsDiscarded(ctx, msg.ID, models.FailureReasonNoHandler, actor); err != nil {
 			p.logger.Error("Failed to mark message as discarded",
 				"error", err,
 				"messageID", msg.ID,)
@@ -201,18 +230,34 @@ func (p *DeadLetterProcessor) processMessage(ctx context.Context, msg *models.De
 		MaxAttempts: p.maxRetries,
 		BackoffStrategy: p.backoffStrategy,
 		Logger: p.logger,
+		Classifier: p.isRetryable,
 	}
 
 	// Define the retryable function
 	retryFunc := func() error {
-		return handler.HandleMessage(ctx, outboxMsg)
+		err := handler.HandleMessage(ctx, outboxMsg)
+
+		if err != nil {
+			// Keep every failed attempt in the history, not just the last one
+			errMsg := err.Error()
+
+			if recordErr := p.dlqRepo.RecordEvent(ctx, msg.ID, models.DeadLetterEventRetryFailed, actor, &errMsg); recordErr != nil {
+				p.logger.Error("Failed to record dead letter retry attempt", "error", recordErr, "messageID", msg.ID)
+			}
+		}
+
+		return err
 	}
 
 	// Define what to if all retries fail
 	discardFunc := func(err error) error {
 		reason := fmt.Sprintf("Failed to process message after %d attempts: %v", p.maxRetries, err)
 
-		if markErr := p.dlqRepo.MarkAsDiscarded(ctx, msg.ID, reason); markErr != nil {
+		if !p.isRetryable(err) {
+			reason = fmt.Sprintf("%s: %v", models.FailureReasonNonRetryable, err)
+		}
+
+		if markErr := p.dlqRepo.MarkAsDiscarded(ctx, msg.ID, reason, actor); markErr != nil {
 			p.logger.Error("Failed to mark message as discarded",
 				"error", markErr,
 				"messageID", msg.ID,)
@@ -222,7 +267,7 @@ func (p *DeadLetterProcessor) processMessage(ctx context.Context, msg *models.De
 	}
 
 	// Execute with retry and discard logic
-	err := retry.RetryWithDiscard(ctx, retryFunc, retryConfig, discardFunc)
+	err = retry.RetryWithDiscard(ctx, retryFunc, retryConfig, discardFunc)
 
 	if err != nil {
 		p.logger.Error("Failed to process dead letter message with retries",
@@ -234,7 +279,7 @@ func (p *DeadLetterProcessor) processMessage(ctx context.Context, msg *models.De
 	}
 
 		// Mark as resolved
-	if err := p.dlqRepo.MarkAsResolved(ctx, msg.ID); err != nil {
+	if err := p.dlqRepo.MarkAsResolved(ctx, msg.ID, actor); err != nil {
 		p.logger.Error("Failed to mark dead letter message as resolved", "error", err, "messageID", msg.ID)
 		return fmt.Errorf("failed to mark message as resolved: %w", err)
 	}
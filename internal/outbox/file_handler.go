@@ -0,0 +1,94 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/vaidashi/fault-tolerant-api/internal/models"
+	apperrors "github.com/vaidashi/fault-tolerant-api/pkg/errors"
+	"github.com/vaidashi/fault-tolerant-api/pkg/logger"
+)
+
+// fileRecord is a single NDJSON line written by the FileHandler
+type fileRecord struct {
+	MessageID     int64           `json:"message_id"`
+	AggregateType string          `json:"aggregate_type"`
+	AggregateID   string          `json:"aggregate_id"`
+	EventType     string          `json:"event_type"`
+	CorrelationID *string         `json:"correlation_id,omitempty"`
+	Payload       json.RawMessage `json:"payload"`
+	WrittenAt     time.Time       `json:"written_at"`
+}
+
+// FileHandler appends outbox messages to a newline delimited JSON file
+type FileHandler struct {
+	mu     sync.Mutex
+	file   *os.File
+	logger logger.Logger
+}
+
+// NewFileHandler creates a new FileHandler appending to the file at path
+func NewFileHandler(path string, logger logger.Logger) (*FileHandler, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to open outbox file %s: %w", path, err)
+	}
+
+	return &FileHandler{
+		file:   file,
+		logger: logger,
+	}, nil
+}
+
+// HandleMessage handles an outbox message by appending it to the file
+func (h *FileHandler) HandleMessage(ctx context.Context, message *models.OutboxMessage) error {
+	if !json.Valid(message.Payload) {
+		return fmt.Errorf("%w: outbox message payload is not valid JSON", apperrors.ErrPermanentFailure)
+	}
+
+	line, err := json.Marshal(fileRecord{
+		MessageID:     message.ID,
+		AggregateType: message.AggregateType,
+		AggregateID:   message.AggregateID,
+		EventType:     message.EventType,
+		CorrelationID: message.CorrelationID,
+		Payload:       message.Payload,
+		WrittenAt:     time.Now(),
+	})
+
+	if err != nil {
+		return fmt.Errorf("%w: failed to marshal outbox record: %v", apperrors.ErrPermanentFailure, err)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, err := h.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write outbox record: %w", err)
+	}
+
+	// The message is marked completed once we return, so make sure it's on disk
+	if err := h.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync outbox file: %w", err)
+	}
+
+	h.logger.Debug("Wrote outbox message to file",
+		"file", h.file.Name(),
+		"messageID", message.ID,
+		"eventType", message.EventType)
+
+	return nil
+}
+
+// Close closes the underlying file
+func (h *FileHandler) Close() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.file.Close()
+}
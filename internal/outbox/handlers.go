@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 
 	"github.com/vaidashi/fault-tolerant-api/internal/models"
+	apperrors "github.com/vaidashi/fault-tolerant-api/pkg/errors"
 	"github.com/vaidashi/fault-tolerant-api/pkg/logger"
 )
 
@@ -26,7 +27,8 @@ func (h *LoggingHandler) HandleMessage(ctx context.Context, message *models.Outb
 	var event models.OutboxMessageEvent
 
 	if err := json.Unmarshal(message.Payload, &event); err != nil {
-		return fmt.Errorf("failed to unmarshal outbox message: %w", err)
+		// A malformed payload will never unmarshal, retrying won't help
+		return fmt.Errorf("%w: failed to unmarshal outbox message: %v", apperrors.ErrPermanentFailure, err)
 	}
 
 	// Simulate message processing
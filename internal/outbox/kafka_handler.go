@@ -2,12 +2,15 @@ package outbox
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
     "math/rand"
 
 	"github.com/vaidashi/fault-tolerant-api/internal/models"
+	apperrors "github.com/vaidashi/fault-tolerant-api/pkg/errors"
 	"github.com/vaidashi/fault-tolerant-api/pkg/kafka"
 	"github.com/vaidashi/fault-tolerant-api/pkg/logger"
+	"github.com/vaidashi/fault-tolerant-api/pkg/tracing"
 )
 
 // KafkaHandler publishes outbox messages to Kafka
@@ -30,12 +33,26 @@ func NewKafkaHandler(producer *kafka.Producer, topic string, logger logger.Logge
 
 // HandleMessage handles an outbox message by publishing it to Kafka
 func (h *KafkaHandler) HandleMessage(ctx context.Context, message *models.OutboxMessage) error {
+    select {
+    case err := <-h.PublishMessage(ctx, message):
+        return err
+    case <-ctx.Done():
+        return ctx.Err()
+    }
+}
+
+// PublishMessage starts publishing an outbox message to Kafka, the returned channel
+// receives the result once the broker acknowledged or rejected it
+func (h *KafkaHandler) PublishMessage(ctx context.Context, message *models.OutboxMessage) <-chan error {
+    result := make(chan error, 1)
+
     // Simulate random failures for testing
 	if rand.Float64() < h.failureRate {
 		h.logger.Warn("Simulating random failure in Kafka publishing", 
 			"messageID", message.ID,
 			"aggregateID", message.AggregateID)
-		return fmt.Errorf("simulated random failure in Kafka publishing")
+		result <- fmt.Errorf("simulated random failure in Kafka publishing")
+		return result
 	}
     // Use the aggregate ID (order ID) as the Kafka message key for partitioning
     key := message.AggregateID
@@ -46,20 +63,68 @@ func (h *KafkaHandler) HandleMessage(ctx context.Context, message *models.Outbox
         "aggregateID", message.AggregateID, 
         "eventType", message.EventType)
     
-    // Send the message to Kafka
-    err := h.producer.SendMessage(ctx, h.topic, key, message.Payload)
+    headers, err := h.eventHeaders(message)
 
     if err != nil {
-        h.logger.Error("Failed to publish message to Kafka", 
-            "error", err, 
+        result <- err
+        return result
+    }
+
+    // Send the message to Kafka
+    delivery := h.producer.Publish(ctx, h.topic, key, message.Payload, headers)
+
+    go func() {
+        d := <-delivery
+
+        if d.Err != nil {
+            h.logger.Error("Failed to publish message to Kafka", 
+                "error", d.Err, 
+                "messageID", message.ID, 
+                "aggregateID", message.AggregateID)
+            result <- fmt.Errorf("failed to publish message to Kafka: %w", d.Err)
+            return
+        }
+
+        h.logger.Info("Successfully published message to Kafka", 
             "messageID", message.ID, 
-            "aggregateID", message.AggregateID)
-        return fmt.Errorf("failed to publish message to Kafka: %w", err)
+            "aggregateID", message.AggregateID,
+            "partition", d.Partition,
+            "offset", d.Offset)
+
+        result <- nil
+    }()
+
+    return result
+}
+
+// eventHeaders builds the record headers describing an outbox message
+func (h *KafkaHandler) eventHeaders(message *models.OutboxMessage) (map[string]string, error) {
+    var event models.OutboxMessageEvent
+
+    if err := json.Unmarshal(message.Payload, &event); err != nil {
+        return nil, fmt.Errorf("%w: failed to unmarshal outbox message: %v", apperrors.ErrPermanentFailure, err)
     }
-    
-    h.logger.Info("Successfully published message to Kafka", 
-        "messageID", message.ID, 
-        "aggregateID", message.AggregateID)
-    
-    return nil
-}
\ No newline at end of file
+
+    headers := map[string]string{
+        kafka.HeaderEventType:     message.EventType,
+        kafka.HeaderEventID:       event.EventID,
+        kafka.HeaderAggregateType: message.AggregateType,
+        kafka.HeaderAggregateID:   message.AggregateID,
+        kafka.HeaderSchemaVersion: models.EventSchemaVersion,
+    }
+
+    if message.CorrelationID != nil {
+        headers[kafka.HeaderCorrelationID] = *message.CorrelationID
+    }
+
+    // Publishing is a child span of the request that produced the message
+    traceParent := ""
+
+    if message.TraceParent != nil {
+        traceParent = *message.TraceParent
+    }
+
+    headers[kafka.HeaderTraceParent] = tracing.ChildTraceParent(traceParent)
+
+    return headers, nil
+}
@@ -0,0 +1,61 @@
+package outbox
+
+import (
+	"context"
+	"sync"
+
+	"github.com/vaidashi/fault-tolerant-api/internal/models"
+)
+
+// MemoryHandler keeps outbox messages in memory, it's meant for tests and
+// local development where no external sink is available
+type MemoryHandler struct {
+	mu       sync.Mutex
+	messages []*models.OutboxMessage
+	err      error
+}
+
+// NewMemoryHandler creates a new MemoryHandler
+func NewMemoryHandler() *MemoryHandler {
+	return &MemoryHandler{}
+}
+
+// HandleMessage handles an outbox message by storing a copy of it
+func (h *MemoryHandler) HandleMessage(ctx context.Context, message *models.OutboxMessage) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.err != nil {
+		return h.err
+	}
+
+	stored := *message
+	stored.Payload = append([]byte(nil), message.Payload...)
+	h.messages = append(h.messages, &stored)
+
+	return nil
+}
+
+// Messages returns the messages handled so far in delivery order
+func (h *MemoryHandler) Messages() []*models.OutboxMessage {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return append([]*models.OutboxMessage(nil), h.messages...)
+}
+
+// FailWith makes subsequent deliveries fail with err, nil restores normal delivery
+func (h *MemoryHandler) FailWith(err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.err = err
+}
+
+// Reset drops all stored messages
+func (h *MemoryHandler) Reset() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.messages = nil
+}
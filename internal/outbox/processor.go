@@ -2,10 +2,12 @@ package outbox
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sync"
 	"time"
 
+	"github.com/lib/pq"
 	"github.com/vaidashi/fault-tolerant-api/internal/models"
 	"github.com/vaidashi/fault-tolerant-api/internal/repository"
 	"github.com/vaidashi/fault-tolerant-api/pkg/logger"
@@ -17,6 +19,16 @@ type MessageHandler interface {
 	HandleMessage(ctx context.Context, message *models.OutboxMessage) error
 }
 
+// AsyncMessageHandler is implemented by handlers that can start delivering a message
+// and report the result later, so a pipelined processor keeps many deliveries in flight
+type AsyncMessageHandler interface {
+	MessageHandler
+	PublishMessage(ctx context.Context, message *models.OutboxMessage) <-chan error
+}
+
+// errNoHandler is reported for messages whose event type has no registered handler
+var errNoHandler = errors.New("no handler registered for event type")
+
 // Processor is responsible for processing outbox messages
 type Processor struct {
 	outboxRepo   *repository.OutboxRepository
@@ -24,8 +36,16 @@ type Processor struct {
 	handlers map[string]MessageHandler
 	pollingInterval time.Duration
 	batchSize      int
+	concurrency    int
+	pipelined      bool
+	instanceID     string
+	leaseDuration  time.Duration
+	reaperInterval time.Duration
+	useNotify      bool
+	retryWakeup    chan struct{}
 	maxRetries      int
 	backoffStrategy retry.BackoffStrategy
+	isRetryable    retry.ErrorClassifier
 	useDLQ bool
 	logger         logger.Logger
 	ctx 		 context.Context
@@ -39,8 +59,15 @@ type Processor struct {
 type ProcessorConfig struct {
 	PollingInterval time.Duration
 	BatchSize      int
+	Concurrency    int // Number of aggregates processed in parallel
+	Pipelined      bool // Publish the next message of every aggregate in a batch before waiting for acknowledgements, requires an AsyncMessageHandler
+	InstanceID     string // Owner recorded on claimed messages
+	LeaseDuration  time.Duration // How long a claim is held before other instances may take over
+	ReaperInterval time.Duration // How often expired claims are returned to pending
+	UseNotify      bool // Wake up on Postgres notifications, PollingInterval becomes the fallback
 	MaxRetries     int
 	BackoffStrategy retry.BackoffStrategy
+	ErrorClassifier retry.ErrorClassifier // Decides which handler errors are retried, defaults to retry.RetryUnlessPermanent
 	UseDLQ		 bool
 }
 
@@ -58,6 +85,36 @@ func NewProcessor(
 	if backoffStrategy == nil {
 		backoffStrategy = retry.NewDefaultExponentialBackoff()
 	}
+
+	isRetryable := config.ErrorClassifier
+
+	if isRetryable == nil {
+		isRetryable = retry.RetryUnlessPermanent
+	}
+
+	concurrency := config.Concurrency
+
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	instanceID := config.InstanceID
+
+	if instanceID == "" {
+		instanceID = models.GenerateID("outbox")
+	}
+
+	leaseDuration := config.LeaseDuration
+
+	if leaseDuration <= 0 {
+		leaseDuration = 2 * time.Minute
+	}
+
+	reaperInterval := config.ReaperInterval
+
+	if reaperInterval <= 0 {
+		reaperInterval = 30 * time.Second
+	}
     
     return &Processor{
         outboxRepo:      outboxRepo,
@@ -65,8 +122,16 @@ func NewProcessor(
         handlers:        make(map[string]MessageHandler),
         pollingInterval: config.PollingInterval,
         batchSize:       config.BatchSize,
+        concurrency:     concurrency,
+        pipelined:       config.Pipelined,
+        instanceID:      instanceID,
+        leaseDuration:   leaseDuration,
+        reaperInterval:  reaperInterval,
+        useNotify:       config.UseNotify,
+        retryWakeup:     make(chan struct{}, 1),
         maxRetries:      config.MaxRetries,
 		backoffStrategy: backoffStrategy,
+		isRetryable:     isRetryable,
 		useDLQ:         config.UseDLQ,
         logger:          logger,
         ctx:             ctx,
@@ -90,16 +155,25 @@ func (p *Processor) Start() {
 	}
 
 	p.running = true
-	p.wg.Add(1)
+	p.wg.Add(2)
 
 	go func() {
 		defer p.wg.Done()
 		p.processOutbox()
 	}()
 
+	go func() {
+		defer p.wg.Done()
+		p.reapExpiredLeases()
+	}()
+
 	p.logger.Info("Outbox processor started",
 		"pollingInterval", p.pollingInterval,
-		"batchSize", p.batchSize)
+		"batchSize", p.batchSize,
+		"concurrency", p.concurrency,
+		"instanceID", p.instanceID,
+		"leaseDuration", p.leaseDuration,
+		"useNotify", p.useNotify)
 }
 
 // Stop stops the outbox processor
@@ -123,76 +197,318 @@ func (p *Processor) processOutbox() {
 	ticker := time.NewTicker(p.pollingInterval)
 	defer ticker.Stop()
 
+	// A nil channel never fires, leaving only the polling ticker
+	var notifications <-chan *pq.Notification
+
+	if p.useNotify {
+		listener, err := p.outboxRepo.ListenForMessages()
+
+		if err != nil {
+			p.logger.Warn("Failed to listen for outbox notifications, falling back to polling", "error", err)
+		} else {
+			defer listener.Close()
+			notifications = listener.Notify
+		}
+	}
+
 	for {
 		select {
 		case <-p.ctx.Done():
 			return
 		case <-ticker.C:
-			if err := p.processBatch(); err != nil {
-				p.logger.Error("Failed to process outbox batch", "error", err)
+			p.processAvailable()
+		case <-p.retryWakeup:
+			p.processAvailable()
+		case <-notifications:
+			// A nil notification means the listener reconnected and may have
+			// missed messages, which the batch below picks up as well
+			p.drainNotifications(notifications)
+			p.processAvailable()
+		}
+	}
+}
+
+// drainNotifications discards queued notifications so a burst of inserts
+// results in a single wake-up
+func (p *Processor) drainNotifications(notifications <-chan *pq.Notification) {
+	for {
+		select {
+		case <-notifications:
+		default:
+			return
+		}
+	}
+}
+
+// processAvailable processes batches until fewer than a full batch is pending
+func (p *Processor) processAvailable() {
+	for {
+		count, err := p.processBatch()
+
+		if err != nil {
+			p.logger.Error("Failed to process outbox batch", "error", err)
+			return
+		}
+
+		if count < p.batchSize || p.ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// reapExpiredLeases periodically returns messages whose claim has expired,
+// for example because the owning instance crashed, back to pending
+func (p *Processor) reapExpiredLeases() {
+	ticker := time.NewTicker(p.reaperInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.ctx.Done():
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(p.ctx, p.reaperInterval)
+			released, err := p.outboxRepo.ReleaseExpiredLeases(ctx)
+			cancel()
+
+			if err != nil {
+				p.logger.Error("Failed to release expired outbox leases", "error", err)
+				continue
+			}
+
+			if released > 0 {
+				p.logger.Warn("Released expired outbox leases", "count", released)
 			}
 		}
 	}
 }
 
-// processBatch processes a batch of outbox messages
-func (p *Processor) processBatch() error {
+// processBatch processes a batch of outbox messages and returns how many were claimed
+func (p *Processor) processBatch() (int, error) {
 	ctx, cancel := context.WithTimeout(p.ctx, p.pollingInterval)
 	defer cancel()
 
-	messages, err := p.outboxRepo.GetPendingMessages(ctx, p.batchSize)
+	messages, err := p.outboxRepo.ClaimPendingMessages(ctx, p.instanceID, p.leaseDuration, p.batchSize)
 
 	if err != nil {
-		return fmt.Errorf("failed to get pending messages: %w", err)
+		return 0, fmt.Errorf("failed to claim pending messages: %w", err)
 	}
 
 	if len(messages) == 0 {
 		p.logger.Info("No pending messages to process")
-		return nil
+		return 0, nil
 	}
 
 	p.logger.Info("Processing batch of outbox messages", "count", len(messages))
 
+	// Messages of the same aggregate are processed in order by a single worker,
+	// different aggregates are processed in parallel
+	groups := groupByAggregate(messages)
+
+	if p.pipelined {
+		p.processPipelined(ctx, groups)
+		return len(messages), nil
+	}
+
+	jobs := make(chan []*models.OutboxMessage)
+
+	workers := p.concurrency
+
+	if workers > len(groups) {
+		workers = len(groups)
+	}
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for group := range jobs {
+				p.processAggregate(ctx, group)
+			}
+		}()
+	}
+
+	for _, group := range groups {
+		jobs <- group
+	}
+
+	close(jobs)
+	wg.Wait()
+
+	return len(messages), nil
+}
+
+// groupByAggregate splits a batch into per-aggregate groups, keeping the
+// created_at order of the messages within each group
+func groupByAggregate(messages []*models.OutboxMessage) [][]*models.OutboxMessage {
+	var groups [][]*models.OutboxMessage
+	index := make(map[string]int)
+
 	for _, msg := range messages {
+		key := msg.AggregateType + ":" + msg.AggregateID
+
+		i, exists := index[key]
+
+		if !exists {
+			i = len(groups)
+			index[key] = i
+			groups = append(groups, nil)
+		}
+
+		groups[i] = append(groups[i], msg)
+	}
+
+	return groups
+}
+
+// processAggregate processes the messages of a single aggregate in order
+func (p *Processor) processAggregate(ctx context.Context, messages []*models.OutboxMessage) {
+	for i, msg := range messages {
 		if err := p.processMessage(ctx, msg); err != nil {
-			 p.logger.Error("Failed to process message", 
-                "error", err, 
-                "messageID", msg.ID,
-                "aggregateID", msg.AggregateID,
-                "eventType", msg.EventType)
-            
-            // Continue processing other messages
-            continue
+			p.logger.Error("Failed to process message", 
+				"error", err, 
+				"messageID", msg.ID,
+				"aggregateID", msg.AggregateID,
+				"eventType", msg.EventType)
+
+			// Stop here so later events of this aggregate are not delivered
+			// before this one, they are released for the next batch
+			if remaining := messages[i+1:]; len(remaining) > 0 {
+				p.logger.Warn("Deferring remaining messages for aggregate",
+					"aggregateID", msg.AggregateID,
+					"remaining", len(remaining))
+				p.releaseMessages(ctx, remaining)
+			}
+			return
 		}
 	}
+}
 
-	return nil
+// processPipelined delivers a batch in rounds: each round publishes the next message of
+// every aggregate without waiting, then waits for all the acknowledgements. Aggregates
+// stay in order because a message is only published once the previous one is acknowledged.
+func (p *Processor) processPipelined(ctx context.Context, groups [][]*models.OutboxMessage) {
+	for len(groups) > 0 {
+		results := make([]<-chan error, len(groups))
+
+		for i, group := range groups {
+			results[i] = p.publishMessage(ctx, group[0])
+		}
+
+		var remaining [][]*models.OutboxMessage
+
+		for i, group := range groups {
+			msg := group[0]
+
+			var deliveryErr error
+
+			select {
+			case deliveryErr = <-results[i]:
+			case <-ctx.Done():
+				deliveryErr = ctx.Err()
+			}
+
+			if err := p.finishMessage(ctx, msg, deliveryErr); err != nil {
+				p.logger.Error("Failed to process message",
+					"error", err,
+					"messageID", msg.ID,
+					"aggregateID", msg.AggregateID,
+					"eventType", msg.EventType)
+
+				// Stop here so later events of this aggregate are not delivered
+				// before this one, they are released for the next batch
+				if len(group) > 1 {
+					p.logger.Warn("Deferring remaining messages for aggregate",
+						"aggregateID", msg.AggregateID,
+						"remaining", len(group)-1)
+					p.releaseMessages(ctx, group[1:])
+				}
+				continue
+			}
+
+			if len(group) > 1 {
+				remaining = append(remaining, group[1:])
+			}
+		}
+
+		groups = remaining
+	}
 }
 
-// processMessage processes a single outbox message
+// publishMessage starts delivering a message and returns a channel receiving the result,
+// handlers that can't publish asynchronously deliver it before publishMessage returns
+func (p *Processor) publishMessage(ctx context.Context, msg *models.OutboxMessage) <-chan error {
+	handler, exists := p.handlers[msg.EventType]
+
+	if asyncHandler, ok := handler.(AsyncMessageHandler); ok {
+		return asyncHandler.PublishMessage(ctx, msg)
+	}
+
+	result := make(chan error, 1)
+
+	if !exists {
+		result <- fmt.Errorf("%w: %s", errNoHandler, msg.EventType)
+	} else {
+		result <- handler.HandleMessage(ctx, msg)
+	}
+
+	return result
+}
+
+// releaseMessages returns claimed but unprocessed messages to pending
+func (p *Processor) releaseMessages(ctx context.Context, messages []*models.OutboxMessage) {
+	ids := make([]int64, len(messages))
+
+	for i, msg := range messages {
+		ids[i] = msg.ID
+	}
+
+	if err := p.outboxRepo.ReleaseMessages(ctx, p.instanceID, ids); err != nil {
+		// The reaper will pick them up once the lease expires
+		p.logger.Error("Failed to release outbox messages", "error", err, "count", len(ids))
+	}
+}
+
+// processMessage processes a single claimed outbox message
 func (p *Processor) processMessage(ctx context.Context, msg *models.OutboxMessage) error {
-    // Mark as processing
-    if err := p.outboxRepo.MarkAsProcessing(ctx, msg.ID); err != nil {
-        return fmt.Errorf("failed to mark message as processing: %w", err)
-    }
-    
     // Find appropriate handler
     handler, exists := p.handlers[msg.EventType]
 
     if !exists {
-        errorMsg := fmt.Sprintf("no handler registered for event type: %s", msg.EventType)
+        return p.finishMessage(ctx, msg, fmt.Errorf("%w: %s", errNoHandler, msg.EventType))
+    }
+
+    // Attempt delivery once, failures are rescheduled instead of retried inline
+    // so they survive restarts and don't hold up the rest of the batch
+    return p.finishMessage(ctx, msg, handler.HandleMessage(ctx, msg))
+}
+
+// finishMessage records the outcome of a delivery attempt, marking the message as
+// completed or scheduling its retry
+func (p *Processor) finishMessage(ctx context.Context, msg *models.OutboxMessage, err error) error {
+    if errors.Is(err, errNoHandler) {
+        errorMsg := err.Error()
         p.logger.Error(errorMsg, "messageID", msg.ID)
         
         // Mark as failed
-        if err := p.outboxRepo.MarkAsFailed(ctx, msg.ID, errorMsg); err != nil {
+        if err := p.outboxRepo.MarkAsFailed(ctx, msg.ID, p.instanceID, errorMsg); err != nil {
             p.logger.Error("Failed to mark message as failed", "error", err, "messageID", msg.ID)
+
+            // Another instance owns the message now and will dead letter it itself
+            if errors.Is(err, repository.ErrLeaseLost) {
+                return err
+            }
         }
 
 		// Send to DLQ if enabled
 		if p.useDLQ && p.dlqRepo != nil {
-			dlqMsg := models.NewDeadLetterMessage(msg, errorMsg, "No handler available")
+			dlqMsg := models.NewDeadLetterMessage(msg, errorMsg, models.FailureReasonNoHandler)
 
-			if err := p.dlqRepo.Create(ctx, dlqMsg); err != nil {
+			if err := p.dlqRepo.Create(ctx, dlqMsg, models.DeadLetterActorOutboxProcessor); err != nil {
 				p.logger.Error("Failed to send message to dead letter queue", 
 					"error", err, 
 					"messageID", msg.ID, 
@@ -200,65 +516,26 @@ func (p *Processor) processMessage(ctx context.Context, msg *models.OutboxMessag
 			} 
 		}
         
-        return fmt.Errorf(errorMsg)
+        return err
     }
-    
-    // Configure retry options
-	retryConfig := &retry.RetryConfig{
-		MaxAttempts: p.maxRetries,
-		BackoffStrategy: p.backoffStrategy,
-		Logger: p.logger,
-	}
-
-	// Retry function to handle message processing
-	retryFunc := func() error {
-		return handler.HandleMessage(ctx, msg)
-	}
-
-	// Define the discard function to handle failures
-	discardFunc := func(err error) error {
-		// Mark as failed in outbox
-		failedErr := fmt.Sprintf("Failed after %d retries: %v", p.maxRetries, err)
 
-		if markErr := p.outboxRepo.MarkAsFailed(ctx, msg.ID, failedErr); markErr != nil {
-			p.logger.Error("Failed to mark message as failed in outbox", 
-				"error", markErr, 
-				"messageID", msg.ID,
-			)
-		}
-		// Send to DLQ if enabled
-		if p.useDLQ && p.dlqRepo != nil {
-			dlqMsg := models.NewDeadLetterMessage(msg, failedErr, "Max retries exceeded")
-
-			if dlqErr := p.dlqRepo.Create(ctx, dlqMsg); dlqErr != nil {
-				p.logger.Error("Failed to send message to dead letter queue", 
-					"error", dlqErr, 
-					"messageID", msg.ID, 
-				)
-			} else {
-				p.logger.Info("Message sent to dead letter queue", 
-					"messageID", msg.ID, 
-					"dlqID", dlqMsg.ID,
-				)
-			}
-		}
+    if err != nil {
+        // Poison messages fail the same way every time, don't wait for them
+        if !p.isRetryable(err) {
+            failedErr := fmt.Sprintf("Non-retryable error on attempt %d: %v", msg.ProcessingAttempts, err)
+            return p.discardMessage(ctx, msg, err, failedErr, models.FailureReasonNonRetryable)
+        }
 
-		return fmt.Errorf("message failed after %d attempts and was discarded: %w", p.maxRetries, err)
-	}
+        if msg.ProcessingAttempts >= p.maxRetries {
+            failedErr := fmt.Sprintf("Failed after %d retries: %v", p.maxRetries, err)
+            return p.discardMessage(ctx, msg, err, failedErr, models.FailureReasonMaxRetries)
+        }
 
-	// Execute with retry and discard policy
-	err := retry.RetryWithDiscard(ctx, retryFunc, retryConfig, discardFunc)
-	
-	if err != nil {
-		p.logger.Error("Message processing failed after retries", 
-			"error", err, 
-			"messageID", msg.ID, 
-			"attempts", msg.ProcessingAttempts)
-		return err
-	}
+        return p.scheduleRetry(ctx, msg, err)
+    }
 	
 	// Mark as completed
-	if err := p.outboxRepo.MarkAsCompleted(ctx, msg.ID); err != nil {
+	if err := p.outboxRepo.MarkAsCompleted(ctx, msg.ID, p.instanceID); err != nil {
 		p.logger.Error("Failed to mark message as completed", "error", err, "messageID", msg.ID)
 		return fmt.Errorf("failed to mark message as completed: %w", err)
 	}
@@ -269,4 +546,75 @@ func (p *Processor) processMessage(ctx context.Context, msg *models.OutboxMessag
 		"eventType", msg.EventType)
 	
 	return nil
-}
\ No newline at end of file
+}
+
+// scheduleRetry returns a failed message to the queue with its next attempt
+// time computed by the backoff strategy
+func (p *Processor) scheduleRetry(ctx context.Context, msg *models.OutboxMessage, err error) error {
+	backoff := p.backoffStrategy.NextBackoff(msg.ProcessingAttempts)
+	nextAttemptAt := time.Now().UTC().Add(backoff)
+
+	if markErr := p.outboxRepo.ScheduleRetry(ctx, msg.ID, p.instanceID, err.Error(), nextAttemptAt); markErr != nil {
+		// The lease expires and the reaper returns the message to pending
+		return fmt.Errorf("failed to schedule retry: %w", markErr)
+	}
+
+	p.logger.Info("Scheduled retry for outbox message",
+		"error", err,
+		"messageID", msg.ID,
+		"attempt", msg.ProcessingAttempts,
+		"maxRetries", p.maxRetries,
+		"backoff", backoff)
+
+	// Wake up the processor when the retry is due
+	time.AfterFunc(backoff, func() {
+		select {
+		case p.retryWakeup <- struct{}{}:
+		default:
+		}
+	})
+
+	return fmt.Errorf("attempt %d failed, retry scheduled: %w", msg.ProcessingAttempts, err)
+}
+
+// discardMessage marks a message that can't be delivered as failed and
+// sends it to the dead letter queue with the given failure reason
+func (p *Processor) discardMessage(ctx context.Context, msg *models.OutboxMessage, err error, failedErr, reason string) error {
+	// Mark as failed in outbox
+	if markErr := p.outboxRepo.MarkAsFailed(ctx, msg.ID, p.instanceID, failedErr); markErr != nil {
+		p.logger.Error("Failed to mark message as failed in outbox", 
+			"error", markErr, 
+			"messageID", msg.ID,
+		)
+
+		// Another instance owns the message now and will dead letter it itself
+		if errors.Is(markErr, repository.ErrLeaseLost) {
+			return markErr
+		}
+	}
+
+	// Send to DLQ if enabled
+	if p.useDLQ && p.dlqRepo != nil {
+		dlqMsg := models.NewDeadLetterMessage(msg, failedErr, reason)
+
+		if dlqErr := p.dlqRepo.Create(ctx, dlqMsg, models.DeadLetterActorOutboxProcessor); dlqErr != nil {
+			p.logger.Error("Failed to send message to dead letter queue", 
+				"error", dlqErr, 
+				"messageID", msg.ID, 
+			)
+		} else {
+			p.logger.Info("Message sent to dead letter queue", 
+				"messageID", msg.ID, 
+				"dlqID", dlqMsg.ID,
+			)
+		}
+	}
+
+	p.logger.Error("Message processing failed, discarding", 
+		"error", err, 
+		"messageID", msg.ID, 
+		"attempts", msg.ProcessingAttempts,
+		"reason", reason)
+
+	return fmt.Errorf("message failed after %d attempts and was discarded: %w", msg.ProcessingAttempts, err)
+}
@@ -0,0 +1,230 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/vaidashi/fault-tolerant-api/internal/repository"
+	"github.com/vaidashi/fault-tolerant-api/pkg/logger"
+)
+
+// RetentionWorker periodically removes completed outbox messages
+type RetentionWorker struct {
+	outboxRepo *repository.OutboxRepository
+	interval   time.Duration
+	maxAge     time.Duration
+	batchSize  int
+	archive    bool
+	logger     logger.Logger
+	ctx        context.Context
+	cancel     context.CancelFunc
+	wg         sync.WaitGroup
+	running    bool
+	mu         sync.Mutex
+	runMu      sync.Mutex // Held while a retention run is in progress
+	metrics    retentionMetrics
+	metricsMu  sync.RWMutex
+}
+
+// RetentionConfig holds the configuration for the RetentionWorker
+type RetentionConfig struct {
+	Interval  time.Duration // How often the retention job runs
+	MaxAge    time.Duration // Completed messages older than this are removed
+	BatchSize int           // Rows removed per statement
+	Archive   bool          // Move rows to the archive table instead of deleting them
+}
+
+// RetentionResult describes the outcome of a single retention run
+type RetentionResult struct {
+	Removed  int64         `json:"removed"`
+	Batches  int           `json:"batches"`
+	Archived bool          `json:"archived"`
+	Cutoff   time.Time     `json:"cutoff"`
+	Duration time.Duration `json:"duration"`
+}
+
+// retentionMetrics tracks the retention worker's activity
+type retentionMetrics struct {
+	runs         int64
+	totalRemoved int64
+	lastRunAt    time.Time
+	lastResult   RetentionResult
+	lastError    string
+}
+
+// ErrRetentionRunning is returned when a retention run is already in progress
+var ErrRetentionRunning = errors.New("retention run already in progress")
+
+// NewRetentionWorker creates a new RetentionWorker
+func NewRetentionWorker(outboxRepo *repository.OutboxRepository, logger logger.Logger, config *RetentionConfig) *RetentionWorker {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// Set default values if not provided
+	batchSize := config.BatchSize
+
+	if batchSize <= 0 {
+		batchSize = 500
+	}
+
+	return &RetentionWorker{
+		outboxRepo: outboxRepo,
+		interval:   config.Interval,
+		maxAge:     config.MaxAge,
+		batchSize:  batchSize,
+		archive:    config.Archive,
+		logger:     logger,
+		ctx:        ctx,
+		cancel:     cancel,
+		running:    false,
+	}
+}
+
+// Start starts the retention worker
+func (w *RetentionWorker) Start() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.running {
+		return
+	}
+
+	w.running = true
+	w.wg.Add(1)
+
+	go func() {
+		defer w.wg.Done()
+		w.runRetention()
+	}()
+
+	w.logger.Info("Outbox retention worker started",
+		"interval", w.interval,
+		"maxAge", w.maxAge,
+		"batchSize", w.batchSize,
+		"archive", w.archive)
+}
+
+// Stop stops the retention worker
+func (w *RetentionWorker) Stop() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if !w.running {
+		return
+	}
+
+	w.cancel()
+	w.wg.Wait()
+	w.running = false
+
+	w.logger.Info("Outbox retention worker stopped")
+}
+
+// runRetention runs the retention job in a loop
+func (w *RetentionWorker) runRetention() {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := w.RunOnce(w.ctx); err != nil && !errors.Is(err, ErrRetentionRunning) {
+				w.logger.Error("Failed to run outbox retention", "error", err)
+			}
+		}
+	}
+}
+
+// RunOnce removes completed messages older than the max age in batches until none are left
+func (w *RetentionWorker) RunOnce(ctx context.Context) (*RetentionResult, error) {
+	if !w.runMu.TryLock() {
+		return nil, ErrRetentionRunning
+	}
+	defer w.runMu.Unlock()
+
+	start := time.Now()
+	result := &RetentionResult{
+		Archived: w.archive,
+		Cutoff:   start.UTC().Add(-w.maxAge),
+	}
+
+	var err error
+
+	for ctx.Err() == nil {
+		var removed int64
+
+		if w.archive {
+			removed, err = w.outboxRepo.ArchiveCompletedBefore(ctx, result.Cutoff, w.batchSize)
+		} else {
+			removed, err = w.outboxRepo.DeleteCompletedBefore(ctx, result.Cutoff, w.batchSize)
+		}
+
+		if err != nil {
+			break
+		}
+
+		result.Removed += removed
+		result.Batches++
+
+		// A partial batch means nothing older than the cutoff is left
+		if removed < int64(w.batchSize) {
+			break
+		}
+	}
+
+	result.Duration = time.Since(start)
+	w.recordRun(result, err)
+
+	if err != nil {
+		return result, fmt.Errorf("retention stopped after removing %d messages: %w", result.Removed, err)
+	}
+
+	if result.Removed > 0 {
+		w.logger.Info("Outbox retention completed",
+			"removed", result.Removed,
+			"batches", result.Batches,
+			"archived", result.Archived,
+			"duration", result.Duration)
+	}
+
+	return result, nil
+}
+
+// recordRun updates the metrics with the outcome of a run
+func (w *RetentionWorker) recordRun(result *RetentionResult, err error) {
+	w.metricsMu.Lock()
+	defer w.metricsMu.Unlock()
+
+	w.metrics.runs++
+	w.metrics.totalRemoved += result.Removed
+	w.metrics.lastRunAt = time.Now().UTC()
+	w.metrics.lastResult = *result
+	w.metrics.lastError = ""
+
+	if err != nil {
+		w.metrics.lastError = err.Error()
+	}
+}
+
+// GetMetrics returns metrics about the retention worker
+func (w *RetentionWorker) GetMetrics() map[string]interface{} {
+	w.metricsMu.RLock()
+	defer w.metricsMu.RUnlock()
+
+	return map[string]interface{}{
+		"interval":      w.interval.String(),
+		"max_age":       w.maxAge.String(),
+		"batch_size":    w.batchSize,
+		"archive":       w.archive,
+		"runs":          w.metrics.runs,
+		"total_removed": w.metrics.totalRemoved,
+		"last_run_at":   w.metrics.lastRunAt,
+		"last_removed":  w.metrics.lastResult.Removed,
+		"last_duration": w.metrics.lastResult.Duration.String(),
+		"last_error":    w.metrics.lastError,
+	}
+}
@@ -0,0 +1,129 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/vaidashi/fault-tolerant-api/internal/models"
+	apperrors "github.com/vaidashi/fault-tolerant-api/pkg/errors"
+	"github.com/vaidashi/fault-tolerant-api/pkg/logger"
+	"github.com/vaidashi/fault-tolerant-api/pkg/tracing"
+)
+
+// Headers sent with every webhook delivery
+const (
+	WebhookHeaderSignature = "X-Webhook-Signature"
+	WebhookHeaderTimestamp = "X-Webhook-Timestamp"
+	WebhookHeaderEventType = "X-Event-Type"
+	WebhookHeaderEventID   = "X-Event-ID"
+	WebhookHeaderMessageID = "X-Outbox-Message-ID"
+)
+
+// WebhookHandler delivers outbox messages to an HTTP endpoint
+type WebhookHandler struct {
+	url        string
+	secret     []byte
+	httpClient *http.Client
+	logger     logger.Logger
+}
+
+// NewWebhookHandler creates a new WebhookHandler posting to url and signing
+// each request with secret
+func NewWebhookHandler(url, secret string, timeout time.Duration, logger logger.Logger) *WebhookHandler {
+	return &WebhookHandler{
+		url:    url,
+		secret: []byte(secret),
+		httpClient: &http.Client{
+			Timeout: timeout,
+		},
+		logger: logger,
+	}
+}
+
+// WebhookSignature computes the signature of a webhook body sent at timestamp,
+// receivers recompute it to verify the request came from us and wasn't replayed
+func WebhookSignature(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// HandleMessage handles an outbox message by posting its payload to the webhook
+func (h *WebhookHandler) HandleMessage(ctx context.Context, message *models.OutboxMessage) error {
+	var event models.OutboxMessageEvent
+
+	if err := json.Unmarshal(message.Payload, &event); err != nil {
+		return fmt.Errorf("%w: failed to unmarshal outbox message: %v", apperrors.ErrPermanentFailure, err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.url, bytes.NewReader(message.Payload))
+
+	if err != nil {
+		return fmt.Errorf("%w: failed to create webhook request: %v", apperrors.ErrPermanentFailure, err)
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookHeaderTimestamp, timestamp)
+	req.Header.Set(WebhookHeaderSignature, WebhookSignature(h.secret, timestamp, message.Payload))
+	req.Header.Set(WebhookHeaderEventType, message.EventType)
+	req.Header.Set(WebhookHeaderEventID, event.EventID)
+	req.Header.Set(WebhookHeaderMessageID, strconv.FormatInt(message.ID, 10))
+
+	if message.CorrelationID != nil {
+		req.Header.Set(tracing.CorrelationIDHeader, *message.CorrelationID)
+	}
+
+	traceParent := ""
+
+	if message.TraceParent != nil {
+		traceParent = *message.TraceParent
+	}
+
+	req.Header.Set(tracing.TraceParentHeader, tracing.ChildTraceParent(traceParent))
+
+	h.logger.Info("Delivering message to webhook",
+		"url", h.url,
+		"messageID", message.ID,
+		"aggregateID", message.AggregateID,
+		"eventType", message.EventType)
+
+	resp, err := h.httpClient.Do(req)
+
+	if err != nil {
+		// Network errors and timeouts are worth retrying
+		return apperrors.NewTemporaryError(fmt.Sprintf("webhook request failed: %v", err))
+	}
+	defer resp.Body.Close()
+
+	// Drain the body so the connection can be reused
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		h.logger.Info("Successfully delivered message to webhook",
+			"messageID", message.ID,
+			"statusCode", resp.StatusCode)
+		return nil
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return apperrors.NewRateLimitedError("webhook rate limited delivery")
+	case resp.StatusCode == http.StatusRequestTimeout || resp.StatusCode >= 500:
+		return apperrors.NewTemporaryError(fmt.Sprintf("webhook returned status %d", resp.StatusCode))
+	default:
+		// The receiver rejected the message, sending it again won't change that
+		return apperrors.NewPermanentError(fmt.Sprintf("webhook rejected message with status %d", resp.StatusCode))
+	}
+}
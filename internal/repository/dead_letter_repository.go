@@ -7,16 +7,56 @@ import (
 	"database/sql"
 	"errors"
 
+	"github.com/lib/pq"
 	"github.com/vaidashi/fault-tolerant-api/internal/database"
 	"github.com/vaidashi/fault-tolerant-api/internal/models"
 	"github.com/vaidashi/fault-tolerant-api/pkg/logger"
 )
 
+// ErrNotPending is returned when a dead letter message is no longer pending
+var ErrNotPending = errors.New("dead letter message is not pending")
+
 // DeadLetterRepository handles database operations related to dead letter messages
 type DeadLetterRepository struct {
 	db     *database.Database
 	logger logger.Logger
 }
+// DeadLetterFilter narrows down the dead letter messages returned by List and Count
+type DeadLetterFilter struct {
+	Status        string
+	EventType     string
+	FailureReason string // Matches any failure reason containing this text
+	AggregateID   string
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+}
+
+// where returns a builder holding the SQL conditions for the filter
+func (f *DeadLetterFilter) where() *whereBuilder {
+	b := &whereBuilder{}
+
+	if f.Status != "" {
+		b.add("status = %s", f.Status)
+	}
+	if f.EventType != "" {
+		b.add("event_type = %s", f.EventType)
+	}
+	if f.FailureReason != "" {
+		b.add("failure_reason ILIKE '%%' || %s || '%%' ESCAPE '\\'", escapeLike(f.FailureReason))
+	}
+	if f.AggregateID != "" {
+		b.add("aggregate_id = %s", f.AggregateID)
+	}
+	if f.CreatedAfter != nil {
+		b.add("created_at >= %s", *f.CreatedAfter)
+	}
+	if f.CreatedBefore != nil {
+		b.add("created_at < %s", *f.CreatedBefore)
+	}
+
+	return b
+}
+
 // NewDeadLetterRepository creates a new DeadLetterRepository
 func NewDeadLetterRepository(db *database.Database, logger logger.Logger) *DeadLetterRepository {
 	return &DeadLetterRepository{
@@ -25,15 +65,20 @@ func NewDeadLetterRepository(db *database.Database, logger logger.Logger) *DeadL
 	}
 }
 
-// Create inserts a new dead letter message
-func (r *DeadLetterRepository) Create(ctx context.Context, message *models.DeadLetterMessage) error {
+// Create inserts a new dead letter message and starts its history
+func (r *DeadLetterRepository) Create(ctx context.Context, message *models.DeadLetterMessage, actor string) error {
 	query := `
-		INSERT INTO dead_letter_messages (
-			original_message_id, aggregate_type, aggregate_id, event_type, payload,
-			error_message, failure_reason, retry_count, status, created_at
-		) VALUES (
-			$1, $2, $3, $4, $5, $6, $7, $8, $9, $10
-		) RETURNING id
+		WITH inserted AS (
+			INSERT INTO dead_letter_messages (
+				original_message_id, aggregate_type, aggregate_id, event_type, payload,
+				error_message, failure_reason, retry_count, status, created_at
+			) VALUES (
+				$1, $2, $3, $4, $5, $6, $7, $8, $9, $10
+			) RETURNING id, status
+		)
+		INSERT INTO dead_letter_events (dead_letter_id, event, to_status, actor, error, created_at)
+		SELECT id, $11::varchar, status, $12::varchar, $6, $10 FROM inserted
+		RETURNING dead_letter_id
 	`
 
 	var id int64
@@ -51,6 +96,8 @@ func (r *DeadLetterRepository) Create(ctx context.Context, message *models.DeadL
 		message.RetryCount,
 		message.Status,
 		message.CreatedAt,
+		string(models.DeadLetterEventCreated),
+		actor,
 	).Scan(&id)
 
 	if err != nil {
@@ -62,8 +109,9 @@ func (r *DeadLetterRepository) Create(ctx context.Context, message *models.DeadL
 	return nil
 }
 
-// GetPendingMessages retrieves pending dead letter messages
-func (r *DeadLetterRepository) GetPendingMessages(ctx context.Context, limit int) ([]*models.DeadLetterMessage, error) {
+// GetPendingMessages retrieves pending dead letter messages, skipping those
+// whose failure reason is one of excludeReasons
+func (r *DeadLetterRepository) GetPendingMessages(ctx context.Context, limit int, excludeReasons ...string) ([]*models.DeadLetterMessage, error) {
 	query := `
 		SELECT 
 			id, original_message_id, aggregate_type, aggregate_id, event_type, payload,
@@ -72,6 +120,7 @@ func (r *DeadLetterRepository) GetPendingMessages(ctx context.Context, limit int
 			dead_letter_messages
 		WHERE 
 			status = $1
+			AND (failure_reason IS NULL OR NOT (failure_reason = ANY($3)))
 		ORDER BY 
 			created_at ASC
 		LIMIT $2
@@ -85,6 +134,7 @@ func (r *DeadLetterRepository) GetPendingMessages(ctx context.Context, limit int
 		query,
 		string(models.DeadLetterStatusPending),
 		limit,
+		pq.Array(excludeReasons),
 	)
 
 	if err != nil {
@@ -95,25 +145,60 @@ func (r *DeadLetterRepository) GetPendingMessages(ctx context.Context, limit int
 	return messages, nil
 }
 
-// MarkAsRetrying marks a message as being retried
-func (r *DeadLetterRepository) MarkAsRetrying(ctx context.Context, id int64) error {
-	query := `
-		UPDATE dead_letter_messages
-		SET 
-			status = $1,
-			retry_count = retry_count + 1,
-			last_retry_at = $2
-		WHERE 
-			id = $3
-	`
+// recordEventQuery appends a history event for a message without changing its status
+const recordEventQuery = `
+	INSERT INTO dead_letter_events (dead_letter_id, event, from_status, to_status, actor, error, created_at)
+	SELECT id, $2::varchar, status, status, $3::varchar, $4::text, $5::timestamp FROM dead_letter_messages WHERE id = $1
+`
+
+// updateWithEvent applies the SET clause to the messages matching the condition and records
+// a history event for every updated row in the same statement, returning the number of rows
+// updated. $1 to $4 hold the event, actor, error and current time, so the SET clause and the
+// condition number their own placeholders from $5.
+func (r *DeadLetterRepository) updateWithEvent(
+	ctx context.Context,
+	event models.DeadLetterEventType,
+	actor string,
+	errMsg *string,
+	set string,
+	condition string,
+	args ...interface{},
+) (int64, error) {
+	query := fmt.Sprintf(`
+		WITH previous AS (
+			SELECT id, status FROM dead_letter_messages WHERE %s FOR UPDATE
+		), updated AS (
+			UPDATE dead_letter_messages d
+			SET %s
+			FROM previous p
+			WHERE d.id = p.id
+			RETURNING d.id, p.status AS from_status, d.status AS to_status
+		)
+		INSERT INTO dead_letter_events (dead_letter_id, event, from_status, to_status, actor, error, created_at)
+		SELECT id, $1::varchar, from_status, to_status, $2::varchar, $3::text, $4::timestamp FROM updated
+	`, condition, set)
+
+	args = append([]interface{}{string(event), actor, errMsg, time.Now().UTC()}, args...)
+
+	result, err := r.db.DB.ExecContext(ctx, query, args...)
 
-	now := time.Now().UTC()
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
 
-	_, err := r.db.DB.ExecContext(
+// MarkAsRetrying marks a message as being retried
+func (r *DeadLetterRepository) MarkAsRetrying(ctx context.Context, id int64, actor string) error {
+	rowsAffected, err := r.updateWithEvent(
 		ctx,
-		query,
+		models.DeadLetterEventRetrying,
+		actor,
+		nil,
+		"status = $5, retry_count = retry_count + 1, last_retry_at = $4",
+		"id = $6",
 		string(models.DeadLetterStatusRetrying),
-		now,
 		id,
 	)
 
@@ -122,27 +207,46 @@ func (r *DeadLetterRepository) MarkAsRetrying(ctx context.Context, id int64) err
 		return fmt.Errorf("%w: %v", ErrDatabase, err)
 	}
 
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+
 	return nil
 }
 
-// MarkAsResolved marks a message as resolved
-func (r *DeadLetterRepository) MarkAsResolved(ctx context.Context, id int64) error {
-	query := `
-		UPDATE dead_letter_messages
-		SET 
-			status = $1,
-			resolved_at = $2
-		WHERE 
-			id = $3
-	`
+// ClaimForRetry marks a pending message as being retried, returning false when
+// another worker already took it or it is no longer pending
+func (r *DeadLetterRepository) ClaimForRetry(ctx context.Context, id int64, actor string) (bool, error) {
+	rowsAffected, err := r.updateWithEvent(
+		ctx,
+		models.DeadLetterEventRetrying,
+		actor,
+		nil,
+		"status = $5, retry_count = retry_count + 1, last_retry_at = $4",
+		"id = $6 AND status = $7",
+		string(models.DeadLetterStatusRetrying),
+		id,
+		string(models.DeadLetterStatusPending),
+	)
+
+	if err != nil {
+		r.logger.Error("Failed to claim dead letter message for retry", "error", err, "messageID", id)
+		return false, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
 
-	now := time.Now().UTC()
+	return rowsAffected == 1, nil
+}
 
-	_, err := r.db.DB.ExecContext(
+// MarkAsResolved marks a message as resolved
+func (r *DeadLetterRepository) MarkAsResolved(ctx context.Context, id int64, actor string) error {
+	rowsAffected, err := r.updateWithEvent(
 		ctx,
-		query,
+		models.DeadLetterEventResolved,
+		actor,
+		nil,
+		"status = $5, resolved_at = $4",
+		"id = $6",
 		string(models.DeadLetterStatusResolved),
-		now,
 		id,
 	)
 
@@ -151,29 +255,23 @@ func (r *DeadLetterRepository) MarkAsResolved(ctx context.Context, id int64) err
 		return fmt.Errorf("%w: %v", ErrDatabase, err)
 	}
 
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+
 	return nil
 }
 
 // MarkAsDiscarded marks a message as permanently discarded
-func (r *DeadLetterRepository) MarkAsDiscarded(ctx context.Context, id int64, reason string) error {
-	query := `
-		UPDATE dead_letter_messages
-		SET 
-			status = $1,
-			failure_reason = CONCAT(failure_reason, ' | Discarded: ', $2),
-			resolved_at = $3
-		WHERE 
-			id = $4
-	`
-
-	now := time.Now().UTC()
-
-	_, err := r.db.DB.ExecContext(
+func (r *DeadLetterRepository) MarkAsDiscarded(ctx context.Context, id int64, reason string, actor string) error {
+	rowsAffected, err := r.updateWithEvent(
 		ctx,
-		query,
+		models.DeadLetterEventDiscarded,
+		actor,
+		&reason,
+		"status = $5, failure_reason = CONCAT(failure_reason, ' | Discarded: ', $3::text), resolved_at = $4",
+		"id = $6",
 		string(models.DeadLetterStatusDiscarded),
-		reason,
-		now,
 		id,
 	)
 
@@ -182,22 +280,181 @@ func (r *DeadLetterRepository) MarkAsDiscarded(ctx context.Context, id int64, re
 		return fmt.Errorf("%w: %v", ErrDatabase, err)
 	}
 
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+
 	return nil
 }
 
-// ResetToRetry resets a retrying message back to pending state
-func (r *DeadLetterRepository) ResetToRetry(ctx context.Context, id int64) error {
+// ResolveByOriginalMessageID resolves pending dead letters of an outbox message
+// that has been requeued for delivery
+func (r *DeadLetterRepository) ResolveByOriginalMessageID(ctx context.Context, originalMessageID int64, actor string) error {
+	_, err := r.updateWithEvent(
+		ctx,
+		models.DeadLetterEventResolved,
+		actor,
+		nil,
+		"status = $5, resolved_at = $4",
+		"original_message_id = $6 AND status = $7",
+		string(models.DeadLetterStatusResolved),
+		originalMessageID,
+		string(models.DeadLetterStatusPending),
+	)
+
+	if err != nil {
+		r.logger.Error("Failed to resolve dead letter messages", "error", err, "originalMessageID", originalMessageID)
+		return fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+
+	return nil
+}
+
+// RecordEvent adds an entry to the history of a message without changing its status
+func (r *DeadLetterRepository) RecordEvent(
+	ctx context.Context,
+	id int64,
+	event models.DeadLetterEventType,
+	actor string,
+	errMsg *string,
+) error {
+	_, err := r.db.DB.ExecContext(ctx, recordEventQuery, id, string(event), actor, errMsg, time.Now().UTC())
+
+	if err != nil {
+		r.logger.Error("Failed to record dead letter event", "error", err, "messageID", id, "event", event)
+		return fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+
+	return nil
+}
+
+// ListEvents retrieves the history of a message, oldest first
+func (r *DeadLetterRepository) ListEvents(ctx context.Context, id int64) ([]*models.DeadLetterEvent, error) {
 	query := `
-		UPDATE dead_letter_messages
-		SET 
-			status = $1
+		SELECT 
+			id, dead_letter_id, event, from_status, to_status, actor, error, created_at
+		FROM 
+			dead_letter_events
 		WHERE 
-			id = $2 AND status = $3
+			dead_letter_id = $1
+		ORDER BY 
+			created_at ASC, id ASC
 	`
 
-	_, err := r.db.DB.ExecContext(
+	events := []*models.DeadLetterEvent{}
+
+	if err := r.db.DB.SelectContext(ctx, &events, query, id); err != nil {
+		r.logger.Error("Failed to list dead letter events", "error", err, "messageID", id)
+		return nil, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+
+	return events, nil
+}
+
+// UpdatePayload replaces the payload of a pending message and records the edit
+func (r *DeadLetterRepository) UpdatePayload(ctx context.Context, id int64, payload []byte, editor string) (*models.DeadLetterEdit, error) {
+	tx, err := r.db.DB.BeginTxx(ctx, nil)
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	defer tx.Rollback()
+
+	// Lock the row so the processor cannot redrive it halfway through the edit
+	var current struct {
+		Payload []byte `db:"payload"`
+		Status  string `db:"status"`
+	}
+
+	err = tx.GetContext(ctx, &current, `SELECT payload, status FROM dead_letter_messages WHERE id = $1 FOR UPDATE`, id)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		r.logger.Error("Failed to lock dead letter message", "error", err, "messageID", id)
+		return nil, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+
+	if current.Status != string(models.DeadLetterStatusPending) {
+		return nil, ErrNotPending
+	}
+
+	edit := &models.DeadLetterEdit{
+		DeadLetterID:    id,
+		OriginalPayload: current.Payload,
+		EditedPayload:   payload,
+		EditedBy:        editor,
+		EditedAt:        time.Now().UTC(),
+	}
+
+	err = tx.QueryRowContext(
 		ctx,
-		query,
+		`INSERT INTO dead_letter_edits (dead_letter_id, original_payload, edited_payload, edited_by, edited_at)
+		VALUES ($1, $2, $3, $4, $5) RETURNING id`,
+		edit.DeadLetterID,
+		edit.OriginalPayload,
+		edit.EditedPayload,
+		edit.EditedBy,
+		edit.EditedAt,
+	).Scan(&edit.ID)
+
+	if err != nil {
+		r.logger.Error("Failed to record dead letter edit", "error", err, "messageID", id)
+		return nil, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE dead_letter_messages SET payload = $1 WHERE id = $2`, payload, id); err != nil {
+		r.logger.Error("Failed to update dead letter payload", "error", err, "messageID", id)
+		return nil, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+
+	_, err = tx.ExecContext(ctx, recordEventQuery, id, string(models.DeadLetterEventEdited), models.DeadLetterActorAdminAPI, nil, edit.EditedAt)
+
+	if err != nil {
+		r.logger.Error("Failed to record dead letter edit event", "error", err, "messageID", id)
+		return nil, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+
+	return edit, nil
+}
+
+// ListEdits retrieves the payload edits of a message, oldest first
+func (r *DeadLetterRepository) ListEdits(ctx context.Context, id int64) ([]*models.DeadLetterEdit, error) {
+	query := `
+		SELECT 
+			id, dead_letter_id, original_payload, edited_payload, edited_by, edited_at
+		FROM 
+			dead_letter_edits
+		WHERE 
+			dead_letter_id = $1
+		ORDER BY 
+			edited_at ASC, id ASC
+	`
+
+	edits := []*models.DeadLetterEdit{}
+
+	if err := r.db.DB.SelectContext(ctx, &edits, query, id); err != nil {
+		r.logger.Error("Failed to list dead letter edits", "error", err, "messageID", id)
+		return nil, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+
+	return edits, nil
+}
+
+// ResetToRetry resets a retrying message back to pending state
+func (r *DeadLetterRepository) ResetToRetry(ctx context.Context, id int64, actor string) error {
+	_, err := r.updateWithEvent(
+		ctx,
+		models.DeadLetterEventReset,
+		actor,
+		nil,
+		"status = $5",
+		"id = $6 AND status = $7",
 		string(models.DeadLetterStatusPending),
 		id,
 		string(models.DeadLetterStatusRetrying),
@@ -236,3 +493,63 @@ func (r *DeadLetterRepository) GetMessage(ctx context.Context, id int64) (*model
 
 	return &message, nil
 }
+
+// List retrieves dead letter messages matching the filter, newest first. Pass the cursor
+// returned for the previous page to continue after it; the returned cursor is nil on the last page.
+func (r *DeadLetterRepository) List(ctx context.Context, filter *DeadLetterFilter, after *Cursor, limit int) ([]*models.DeadLetterMessage, *Cursor, error) {
+	b := filter.where()
+
+	if after != nil {
+		b.addRaw(fmt.Sprintf("(created_at, id) < (%s, %s)", b.arg(after.CreatedAt), b.arg(after.ID)))
+	}
+
+	// Fetch one extra row to know whether there is a next page
+	limitPlaceholder := b.arg(limit + 1)
+
+	query := fmt.Sprintf(`
+		SELECT 
+			id, original_message_id, aggregate_type, aggregate_id, event_type, payload,
+			error_message, failure_reason, retry_count, last_retry_at, status, created_at, resolved_at
+		FROM 
+			dead_letter_messages
+		%s
+		ORDER BY 
+			created_at DESC, id DESC
+		LIMIT %s
+	`, b.clause(), limitPlaceholder)
+
+	var messages []*models.DeadLetterMessage
+
+	err := r.db.DB.SelectContext(ctx, &messages, query, b.args...)
+
+	if err != nil {
+		r.logger.Error("Failed to list dead letter messages", "error", err)
+		return nil, nil, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+
+	var next *Cursor
+
+	if len(messages) > limit {
+		messages = messages[:limit]
+		last := messages[len(messages)-1]
+		next = &Cursor{CreatedAt: last.CreatedAt, ID: last.ID}
+	}
+
+	return messages, next, nil
+}
+
+// Count counts the dead letter messages matching the filter
+func (r *DeadLetterRepository) Count(ctx context.Context, filter *DeadLetterFilter) (int, error) {
+	b := filter.where()
+	query := fmt.Sprintf(`SELECT COUNT(*) FROM dead_letter_messages %s`, b.clause())
+
+	var count int
+	err := r.db.DB.GetContext(ctx, &count, query, b.args...)
+
+	if err != nil {
+		r.logger.Error("Failed to count dead letter messages", "error", err)
+		return 0, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+
+	return count, nil
+}
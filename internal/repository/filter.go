@@ -0,0 +1,88 @@
+package repository
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// whereBuilder accumulates SQL conditions with numbered placeholders
+type whereBuilder struct {
+	conditions []string
+	args       []interface{}
+}
+
+// arg registers an argument and returns its placeholder
+func (b *whereBuilder) arg(value interface{}) string {
+	b.args = append(b.args, value)
+	return fmt.Sprintf("$%d", len(b.args))
+}
+
+// add appends a condition, the %s in the condition is replaced by the value's placeholder
+func (b *whereBuilder) add(condition string, value interface{}) {
+	b.conditions = append(b.conditions, fmt.Sprintf(condition, b.arg(value)))
+}
+
+// addRaw appends a condition whose placeholders were already registered with arg
+func (b *whereBuilder) addRaw(condition string) {
+	b.conditions = append(b.conditions, condition)
+}
+
+// clause returns the WHERE clause, or an empty string when there are no conditions
+func (b *whereBuilder) clause() string {
+	if len(b.conditions) == 0 {
+		return ""
+	}
+	return "WHERE " + strings.Join(b.conditions, " AND ")
+}
+
+// likeEscaper escapes the LIKE wildcards and the escape character itself
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// escapeLike escapes a value so it matches literally inside a LIKE pattern using ESCAPE '\'
+func escapeLike(value string) string {
+	return likeEscaper.Replace(value)
+}
+
+// Cursor marks the position of the last row of a page for keyset pagination
+type Cursor struct {
+	CreatedAt time.Time
+	ID        int64
+}
+
+// Encode returns the opaque string representation of the cursor
+func (c *Cursor) Encode() string {
+	raw := fmt.Sprintf("%d:%d", c.CreatedAt.UnixNano(), c.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// DecodeCursor parses a cursor produced by Encode
+func DecodeCursor(value string) (*Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor: %w", err)
+	}
+
+	parts := strings.SplitN(string(raw), ":", 2)
+
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("invalid cursor format")
+	}
+
+	nanos, err := strconv.ParseInt(parts[0], 10, 64)
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor timestamp: %w", err)
+	}
+
+	id, err := strconv.ParseInt(parts[1], 10, 64)
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor id: %w", err)
+	}
+
+	return &Cursor{CreatedAt: time.Unix(0, nanos).UTC(), ID: id}, nil
+}
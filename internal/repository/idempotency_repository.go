@@ -0,0 +1,168 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/vaidashi/fault-tolerant-api/internal/database"
+	"github.com/vaidashi/fault-tolerant-api/internal/models"
+	"github.com/vaidashi/fault-tolerant-api/pkg/logger"
+)
+
+// IdempotencyRepository stores idempotency keys and the responses they produced
+type IdempotencyRepository struct {
+	db     *database.Database
+	logger logger.Logger
+}
+
+// NewIdempotencyRepository creates a new IdempotencyRepository
+func NewIdempotencyRepository(db *database.Database, logger logger.Logger) *IdempotencyRepository {
+	return &IdempotencyRepository{
+		db:     db,
+		logger: logger,
+	}
+}
+
+// Acquire locks an idempotency key for a new request, returning false if the key
+// is already in use. Keys created before expiredBefore are forgotten and can be
+// reused, keys locked before staleBefore without a response belonged to a request
+// that never finished and are taken over if the request matches.
+func (r *IdempotencyRepository) Acquire(ctx context.Context, key *models.IdempotencyKey, staleBefore, expiredBefore time.Time) (bool, error) {
+	_, err := r.db.DB.ExecContext(ctx,
+		`DELETE FROM idempotency_keys WHERE key = $1 AND created_at < $2`,
+		key.Key, expiredBefore)
+
+	if err != nil {
+		r.logger.Error("Failed to delete expired idempotency key", "error", err, "key", key.Key)
+		return false, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+
+	query := `
+		INSERT INTO idempotency_keys (key, request_method, request_path, request_hash, locked_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $5)
+		ON CONFLICT (key) DO UPDATE SET locked_at = EXCLUDED.locked_at
+		WHERE idempotency_keys.response_status IS NULL
+			AND idempotency_keys.locked_at < $6
+			AND idempotency_keys.request_method = EXCLUDED.request_method
+			AND idempotency_keys.request_path = EXCLUDED.request_path
+			AND idempotency_keys.request_hash = EXCLUDED.request_hash
+	`
+
+	result, err := r.db.DB.ExecContext(ctx, query,
+		key.Key,
+		key.RequestMethod,
+		key.RequestPath,
+		key.RequestHash,
+		key.LockedAt,
+		staleBefore,
+	)
+
+	if err != nil {
+		r.logger.Error("Failed to acquire idempotency key", "error", err, "key", key.Key)
+		return false, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+
+	if err != nil {
+		return false, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+
+	return rowsAffected == 1, nil
+}
+
+// Get retrieves an idempotency key
+func (r *IdempotencyRepository) Get(ctx context.Context, key string) (*models.IdempotencyKey, error) {
+	query := `
+		SELECT key, request_method, request_path, request_hash, response_status, response_body,
+			response_headers, locked_at, created_at, completed_at
+		FROM idempotency_keys
+		WHERE key = $1
+	`
+
+	var idempotencyKey models.IdempotencyKey
+	err := r.db.DB.GetContext(ctx, &idempotencyKey, query, key)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		r.logger.Error("Failed to get idempotency key", "error", err, "key", key)
+		return nil, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+
+	return &idempotencyKey, nil
+}
+
+// Complete stores the response produced for an idempotency key, headers is a JSON
+// object of the response headers to replay
+func (r *IdempotencyRepository) Complete(ctx context.Context, key string, status int, headers []byte, body []byte) error {
+	query := `
+		UPDATE idempotency_keys
+		SET response_status = $1, response_headers = $2, response_body = $3, completed_at = $4
+		WHERE key = $5
+	`
+
+	result, err := r.db.DB.ExecContext(ctx, query, status, headers, body, time.Now().UTC(), key)
+
+	if err != nil {
+		r.logger.Error("Failed to complete idempotency key", "error", err, "key", key)
+		return fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// Release deletes an idempotency key whose request didn't complete, so the
+// client can retry it with the same key
+func (r *IdempotencyRepository) Release(ctx context.Context, key string) error {
+	query := `DELETE FROM idempotency_keys WHERE key = $1 AND response_status IS NULL`
+
+	if _, err := r.db.DB.ExecContext(ctx, query, key); err != nil {
+		r.logger.Error("Failed to release idempotency key", "error", err, "key", key)
+		return fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+
+	return nil
+}
+
+// DeleteCreatedBefore deletes up to limit idempotency keys created before cutoff
+func (r *IdempotencyRepository) DeleteCreatedBefore(ctx context.Context, cutoff time.Time, limit int) (int64, error) {
+	query := `
+		DELETE FROM idempotency_keys
+		WHERE key IN (
+			SELECT key FROM idempotency_keys
+			WHERE created_at < $1
+			ORDER BY created_at ASC
+			LIMIT $2
+		)
+	`
+
+	result, err := r.db.DB.ExecContext(ctx, query, cutoff, limit)
+
+	if err != nil {
+		r.logger.Error("Failed to delete expired idempotency keys", "error", err)
+		return 0, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+
+	return rowsAffected, nil
+}
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"database/sql"
 
+	"github.com/lib/pq"
 	"github.com/vaidashi/fault-tolerant-api/internal/database"
 	"github.com/vaidashi/fault-tolerant-api/internal/models"
 	"github.com/vaidashi/fault-tolerant-api/pkg/logger"
@@ -14,8 +15,20 @@ import (
 var (
 	ErrNotFound = errors.New("record not found")
 	ErrDatabase = errors.New("database error")
+	// ErrVersionConflict is returned when a record changed since it was read
+	ErrVersionConflict = errors.New("version conflict")
 )
 
+// updateOrderQuery is a compare-and-swap update that only applies to the version that was read
+const updateOrderQuery = `
+	UPDATE orders
+	SET customer_id = $1, amount = $2, status = $3, description = $4, updated_at = $5, version = version + 1
+	WHERE id = $6 AND version = $7
+`
+
+// orderExistsQuery checks whether an order exists
+const orderExistsQuery = `SELECT EXISTS (SELECT 1 FROM orders WHERE id = $1)`
+
 // OrderRepository handles database operations for orders
 type OrderRepository struct {
 	db     *database.Database
@@ -30,37 +43,32 @@ func NewOrderRepository(db *database.Database, logger logger.Logger) *OrderRepos
 	}
 }
 
-// Create inserts a new order into the database
+// Create inserts a new order with its items and shipping address into the database
 func (r *OrderRepository) Create(ctx context.Context, order *models.Order) error {
-	query := `
-		INSERT INTO orders (id, customer_id, amount, status, description, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7)
-	`
-
-	_, err := r.db.DB.ExecContext(
-		ctx,
-		query,
-		order.ID,
-		order.CustomerID,
-		order.Amount,
-		order.Status,
-		order.Description,
-		order.CreatedAt,
-		order.UpdatedAt,
-	)
+	tx, err := r.BeginTx(ctx)
 
 	if err != nil {
+		return err
+	}
+
+	if err := r.CreateInTx(tx, order); err != nil {
+		tx.Rollback()
 		r.logger.Error("Failed to create order", "error", err, "orderID", order.ID)
 		return fmt.Errorf("%w: %v", ErrDatabase, err)
 	}
 
+	if err := tx.Commit(); err != nil {
+		r.logger.Error("Failed to commit order", "error", err, "orderID", order.ID)
+		return fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+
 	return nil
 }
 
 // GetByID retrieves an order by its ID
 func (r *OrderRepository) GetByID(ctx context.Context, id string) (*models.Order, error) {
 	query := `
-		SELECT id, customer_id, amount, status, description, created_at, updated_at
+		SELECT id, customer_id, amount, status, description, version, created_at, updated_at
 		FROM orders
 		WHERE id = $1
 	`
@@ -76,13 +84,68 @@ func (r *OrderRepository) GetByID(ctx context.Context, id string) (*models.Order
 		return nil, fmt.Errorf("%w: %v", ErrDatabase, err)
 	}
 
+	if err := r.loadDetails(ctx, []*models.Order{&order}); err != nil {
+		return nil, err
+	}
+
 	return &order, nil
 }
 
+// loadDetails fills in the items and shipping address of the given orders
+func (r *OrderRepository) loadDetails(ctx context.Context, orders []*models.Order) error {
+	if len(orders) == 0 {
+		return nil
+	}
+
+	ids := make([]string, len(orders))
+	byID := make(map[string]*models.Order, len(orders))
+
+	for i, order := range orders {
+		ids[i] = order.ID
+		byID[order.ID] = order
+	}
+
+	var items []models.OrderItem
+	itemsQuery := `
+		SELECT id, order_id, product_id, quantity, unit_price
+		FROM order_items
+		WHERE order_id = ANY($1)
+		ORDER BY id
+	`
+
+	if err := r.db.DB.SelectContext(ctx, &items, itemsQuery, pq.Array(ids)); err != nil {
+		r.logger.Error("Failed to get order items", "error", err)
+		return fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+
+	for _, item := range items {
+		order := byID[item.OrderID]
+		order.Items = append(order.Items, item)
+	}
+
+	var addresses []*models.ShippingAddress
+	addressQuery := `
+		SELECT order_id, recipient, line1, line2, city, state, postal_code, country
+		FROM order_shipping_addresses
+		WHERE order_id = ANY($1)
+	`
+
+	if err := r.db.DB.SelectContext(ctx, &addresses, addressQuery, pq.Array(ids)); err != nil {
+		r.logger.Error("Failed to get order shipping addresses", "error", err)
+		return fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+
+	for _, address := range addresses {
+		byID[address.OrderID].ShippingAddress = address
+	}
+
+	return nil
+}
+
 // GetAll retrieves all orders with optional limit and offset
 func (r *OrderRepository) GetAll(ctx context.Context, limit, offset int) ([]*models.Order, error) {
 	query := `
-		SELECT id, customer_id, amount, status, description, created_at, updated_at
+		SELECT id, customer_id, amount, status, description, version, created_at, updated_at
 		FROM orders
 		ORDER BY created_at DESC
 		LIMIT $1 OFFSET $2
@@ -96,26 +159,28 @@ func (r *OrderRepository) GetAll(ctx context.Context, limit, offset int) ([]*mod
 		return nil, fmt.Errorf("%w: %v", ErrDatabase, err)
 	}
 
+	if err := r.loadDetails(ctx, orders); err != nil {
+		return nil, err
+	}
+
 	return orders, nil
 }
 
-// Update updates an existing order
+// Update updates an existing order if its version still matches order.Version,
+// returning ErrVersionConflict if it was changed concurrently
 func (r *OrderRepository) Update(ctx context.Context, order *models.Order) error {
-	query := `
-		UPDATE orders
-		SET customer_id = $1, amount = $2, status = $3, description = $4, updated_at = $5
-		WHERE id = $6
-	`
+	now := models.GetCurrentTime() // Update the updated_at time
 
 	result, err := r.db.DB.ExecContext(
 		ctx,
-		query,
+		updateOrderQuery,
 		order.CustomerID,
 		order.Amount,
 		order.Status,
 		order.Description,
-		models.GetCurrentTime(), // Update the updated_at time
+		now,
 		order.ID,
+		order.Version,
 	)
 
 	if err != nil {
@@ -130,17 +195,21 @@ func (r *OrderRepository) Update(ctx context.Context, order *models.Order) error
 	}
 
 	if rowsAffected == 0 {
-		return ErrNotFound
+		return missingOrConflict(r.db.DB.QueryRowContext(ctx, orderExistsQuery, order.ID))
 	}
 
+	order.Version++
+	order.UpdatedAt = now
+
 	return nil
 }
 
-// Delete deletes an order by its ID
-func (r *OrderRepository) Delete(ctx context.Context, id string) error {
-	query := `DELETE FROM orders WHERE id = $1`
+// Delete deletes an order by its ID, a non-zero version must match the order's
+// current version or ErrVersionConflict is returned
+func (r *OrderRepository) Delete(ctx context.Context, id string, version int) error {
+	query := `DELETE FROM orders WHERE id = $1 AND ($2 = 0 OR version = $2)`
 
-	result, err := r.db.DB.ExecContext(ctx, query, id)
+	result, err := r.db.DB.ExecContext(ctx, query, id, version)
 
 	if err != nil {
 		r.logger.Error("Failed to delete order", "error", err, "orderID", id)
@@ -154,12 +223,31 @@ func (r *OrderRepository) Delete(ctx context.Context, id string) error {
 	}
 
 	if rowsAffected == 0 {
-		return ErrNotFound
+		if version == 0 {
+			return ErrNotFound
+		}
+		return missingOrConflict(r.db.DB.QueryRowContext(ctx, orderExistsQuery, id))
 	}
 
 	return nil
 }
 
+// missingOrConflict explains why a versioned write matched no rows given the
+// result of orderExistsQuery
+func missingOrConflict(row *sql.Row) error {
+	var exists bool
+
+	if err := row.Scan(&exists); err != nil {
+		return fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+
+	if !exists {
+		return ErrNotFound
+	}
+
+	return ErrVersionConflict
+}
+
 // Count counts the total number of orders
 func (r *OrderRepository) Count(ctx context.Context) (int, error) {
 	var count int
@@ -178,7 +266,7 @@ func (r *OrderRepository) Count(ctx context.Context) (int, error) {
 // GetByCustomerID retrieves all orders for a specific customer
 func (r *OrderRepository) GetByCustomerID(ctx context.Context, customerID string, limit, offset int) ([]*models.Order, error) {
 	query := `
-		SELECT id, customer_id, amount, status, description, created_at, updated_at
+		SELECT id, customer_id, amount, status, description, version, created_at, updated_at
 		FROM orders
 		WHERE customer_id = $1
 		ORDER BY created_at DESC
@@ -193,6 +281,10 @@ func (r *OrderRepository) GetByCustomerID(ctx context.Context, customerID string
 		return nil, fmt.Errorf("%w: %v", ErrDatabase, err)
 	}
 
+	if err := r.loadDetails(ctx, orders); err != nil {
+		return nil, err
+	}
+
 	return orders, nil
 }
 
@@ -207,11 +299,11 @@ func (r *OrderRepository) BeginTx(ctx context.Context) (*sql.Tx, error) {
 	return tx, nil
 }
 
-// CreateInTx creates a new order within a transaction
+// CreateInTx creates a new order with its items and shipping address within a transaction
 func (r *OrderRepository) CreateInTx(tx *sql.Tx, order *models.Order) error {
 	query := `
-		INSERT INTO orders (id, customer_id, amount, status, description, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		INSERT INTO orders (id, customer_id, amount, status, description, version, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
 	`
 
 	_, err := tx.Exec(
@@ -221,6 +313,7 @@ func (r *OrderRepository) CreateInTx(tx *sql.Tx, order *models.Order) error {
 		order.Amount,
 		order.Status,
 		order.Description,
+		order.Version,
 		order.CreatedAt,
 		order.UpdatedAt,
 	)
@@ -229,25 +322,63 @@ func (r *OrderRepository) CreateInTx(tx *sql.Tx, order *models.Order) error {
 		return fmt.Errorf("Failed to create order in transaction: %w", err)
 	}
 
+	itemQuery := `
+		INSERT INTO order_items (order_id, product_id, quantity, unit_price)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id
+	`
+
+	for i := range order.Items {
+		item := &order.Items[i]
+		item.OrderID = order.ID
+
+		if err := tx.QueryRow(itemQuery, item.OrderID, item.ProductID, item.Quantity, item.UnitPrice).Scan(&item.ID); err != nil {
+			return fmt.Errorf("Failed to create order item in transaction: %w", err)
+		}
+	}
+
+	if address := order.ShippingAddress; address != nil {
+		address.OrderID = order.ID
+
+		addressQuery := `
+			INSERT INTO order_shipping_addresses (order_id, recipient, line1, line2, city, state, postal_code, country)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		`
+
+		_, err = tx.Exec(
+			addressQuery,
+			address.OrderID,
+			address.Recipient,
+			address.Line1,
+			address.Line2,
+			address.City,
+			address.State,
+			address.PostalCode,
+			address.Country,
+		)
+
+		if err != nil {
+			return fmt.Errorf("Failed to create order shipping address in transaction: %w", err)
+		}
+	}
+
 	return nil
 }
 
-// UpdateInTx updates an existing order within a transaction
+// UpdateInTx updates an existing order within a transaction if its version still
+// matches order.Version, on success the order carries its new version
 func (r *OrderRepository) UpdateInTx(tx *sql.Tx, order *models.Order) error {
-	query := `
-		UPDATE orders
-		SET customer_id = $1, amount = $2, status = $3, description = $4, updated_at = $5
-		WHERE id = $6
-	`
+	now := models.GetCurrentTime() // Update the updated_at time
 
 	result, err := tx.Exec(
-		query,
+		updateOrderQuery,
 		order.CustomerID,
 		order.Amount,
 		order.Status,
 		order.Description,
-		models.GetCurrentTime(), // Update the updated_at time
+		now,
 		order.ID,
+		order.Version,
 	)
 
 	if err != nil {
@@ -261,8 +392,11 @@ func (r *OrderRepository) UpdateInTx(tx *sql.Tx, order *models.Order) error {
 	}
 
 	if rowsAffected == 0 {
-		return ErrNotFound
+		return missingOrConflict(tx.QueryRow(orderExistsQuery, order.ID))
 	}
 
+	order.Version++
+	order.UpdatedAt = now
+
 	return nil
-}
\ No newline at end of file
+}
@@ -5,20 +5,65 @@ import (
     "database/sql"
     "errors"
     "fmt"
+    "sort"
     "time"
 
     // "github.com/jmoiron/sqlx"
+    "github.com/lib/pq"
     "github.com/vaidashi/fault-tolerant-api/internal/database"
     "github.com/vaidashi/fault-tolerant-api/internal/models"
     "github.com/vaidashi/fault-tolerant-api/pkg/logger"
 )
 
+// OutboxNotifyChannel is the Postgres channel notified whenever an outbox message is created
+const OutboxNotifyChannel = "outbox_messages"
+
+// ErrLeaseLost is returned when a message is no longer claimed by the caller,
+// typically because its lease expired and it was released to another instance
+var ErrLeaseLost = errors.New("outbox message lease lost")
+
 // OutboxRepository handles database operations for outbox messages
 type OutboxRepository struct {
 	db *database.Database
 	logger logger.Logger
 }
 
+// OutboxFilter narrows down the outbox messages returned by List and Count
+type OutboxFilter struct {
+	Status        string
+	EventType     string
+	AggregateType string
+	AggregateID   string
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+}
+
+// whereClause builds the SQL conditions and arguments for the filter
+func (f *OutboxFilter) whereClause() (string, []interface{}) {
+	var b whereBuilder
+
+	if f.Status != "" {
+		b.add("status = %s", f.Status)
+	}
+	if f.EventType != "" {
+		b.add("event_type = %s", f.EventType)
+	}
+	if f.AggregateType != "" {
+		b.add("aggregate_type = %s", f.AggregateType)
+	}
+	if f.AggregateID != "" {
+		b.add("aggregate_id = %s", f.AggregateID)
+	}
+	if f.CreatedAfter != nil {
+		b.add("created_at >= %s", *f.CreatedAfter)
+	}
+	if f.CreatedBefore != nil {
+		b.add("created_at < %s", *f.CreatedBefore)
+	}
+
+	return b.clause(), b.args
+}
+
 // NewOutboxRepository creates a new OutboxRepository
 func NewOutboxRepository(db *database.Database, logger logger.Logger) *OutboxRepository {
 	return &OutboxRepository{
@@ -32,9 +77,9 @@ func (r *OutboxRepository) Create(ctx context.Context, message *models.OutboxMes
 	query := `
         INSERT INTO outbox_messages (
             aggregate_type, aggregate_id, event_type, payload, 
-            created_at, status
+            created_at, status, correlation_id, trace_parent
         ) VALUES (
-            $1, $2, $3, $4, $5, $6
+            $1, $2, $3, $4, $5, $6, $7, $8
         ) RETURNING id
     `
 
@@ -49,6 +94,8 @@ func (r *OutboxRepository) Create(ctx context.Context, message *models.OutboxMes
         message.Payload,
         message.CreatedAt,
         message.Status,
+        message.CorrelationID,
+        message.TraceParent,
     ).Scan(&id)
 
     if err != nil {
@@ -57,6 +104,8 @@ func (r *OutboxRepository) Create(ctx context.Context, message *models.OutboxMes
     }
 
     message.ID = id
+    r.notify(ctx, id)
+
     return nil
 }
 
@@ -64,7 +113,8 @@ func (r *OutboxRepository) Create(ctx context.Context, message *models.OutboxMes
 func (r *OutboxRepository) GetPendingMessages(ctx context.Context, limit int) ([]*models.OutboxMessage, error) {
 	query := `
 		SELECT id, aggregate_type, aggregate_id, event_type, payload, 
-			   created_at, processed_at, processing_attempts, last_error, status
+			   created_at, processed_at, processing_attempts, last_error, status,
+			   locked_by, locked_until, next_attempt_at, correlation_id, trace_parent
 		FROM outbox_messages
 		WHERE status = $1
 		ORDER BY created_at ASC
@@ -89,6 +139,200 @@ func (r *OutboxRepository) GetPendingMessages(ctx context.Context, limit int) ([
 	return messages, nil
 }
 
+// ClaimPendingMessages atomically claims up to limit pending messages that are due for the
+// given owner. Rows locked by a concurrent claim are skipped, and aggregates that already
+// have a message in processing or an earlier message waiting for its retry are left alone
+// so their events stay in order.
+//
+// Claims are serialized per aggregate with advisory locks: the aggregates are locked
+// first and claimed in a second statement, whose snapshot is taken after any claim
+// that held the lock before us committed, so its processing rows are visible.
+func (r *OutboxRepository) ClaimPendingMessages(ctx context.Context, owner string, lease time.Duration, limit int) ([]*models.OutboxMessage, error) {
+	now := time.Now().UTC()
+
+	tx, err := r.db.DB.BeginTxx(ctx, nil)
+
+	if err != nil {
+		r.logger.Error("Failed to begin claim transaction", "error", err, "owner", owner)
+		return nil, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	defer tx.Rollback()
+
+	// Each aggregate is ranked by its oldest pending message and only picked when that message
+	// is due and nothing of the aggregate is in processing, so aggregates waiting for a retry
+	// or a lease don't take the place of claimable ones. The LIMIT in the subquery makes sure
+	// locks are only taken on the candidates.
+	lockQuery := `
+		SELECT aggregate_type, aggregate_id
+		FROM (
+			SELECT aggregate_type, aggregate_id, head
+			FROM (
+				SELECT DISTINCT ON (aggregate_type, aggregate_id)
+					aggregate_type, aggregate_id, id AS head, next_attempt_at
+				FROM outbox_messages
+				WHERE status = $1
+				ORDER BY aggregate_type, aggregate_id, id
+			) heads
+			WHERE (heads.next_attempt_at IS NULL OR heads.next_attempt_at <= $2)
+			AND NOT EXISTS (
+				SELECT 1 FROM outbox_messages p
+				WHERE p.aggregate_type = heads.aggregate_type
+				AND p.aggregate_id = heads.aggregate_id
+				AND p.status = $4
+			)
+			ORDER BY head
+			LIMIT $3
+		) candidates
+		WHERE pg_try_advisory_xact_lock(hashtext(aggregate_type || ':' || aggregate_id))
+	`
+
+	var aggregates []struct {
+		AggregateType string `db:"aggregate_type"`
+		AggregateID   string `db:"aggregate_id"`
+	}
+
+	if err := tx.SelectContext(ctx, &aggregates, lockQuery,
+		models.OutboxStatusPending, now, limit, models.OutboxStatusProcessing); err != nil {
+		r.logger.Error("Failed to lock outbox aggregates", "error", err, "owner", owner)
+		return nil, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+
+	if len(aggregates) == 0 {
+		return nil, nil
+	}
+
+	aggregateTypes := make([]string, len(aggregates))
+	aggregateIDs := make([]string, len(aggregates))
+
+	for i, aggregate := range aggregates {
+		aggregateTypes[i] = aggregate.AggregateType
+		aggregateIDs[i] = aggregate.AggregateID
+	}
+
+	query := `
+		UPDATE outbox_messages
+		SET status = $1, processing_attempts = processing_attempts + 1,
+			locked_by = $2, locked_until = $3
+		WHERE id IN (
+			SELECT o.id
+			FROM outbox_messages o
+			WHERE o.status = $4
+			AND (o.next_attempt_at IS NULL OR o.next_attempt_at <= $6)
+			AND (o.aggregate_type, o.aggregate_id) IN (
+				SELECT * FROM unnest($7::text[], $8::text[])
+			)
+			AND NOT EXISTS (
+				SELECT 1 FROM outbox_messages p
+				WHERE p.aggregate_type = o.aggregate_type
+				AND p.aggregate_id = o.aggregate_id
+				AND (
+					p.status = $1
+					OR (p.status = $4 AND p.id < o.id AND p.next_attempt_at > $6)
+				)
+			)
+			ORDER BY o.created_at ASC, o.id ASC
+			LIMIT $5
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, aggregate_type, aggregate_id, event_type, payload,
+			created_at, processed_at, processing_attempts, last_error, status,
+			locked_by, locked_until, next_attempt_at, correlation_id, trace_parent
+	`
+
+	var messages []*models.OutboxMessage
+
+	err = tx.SelectContext(
+		ctx,
+		&messages,
+		query,
+		models.OutboxStatusProcessing,
+		owner,
+		now.Add(lease),
+		models.OutboxStatusPending,
+		limit,
+		now,
+		pq.Array(aggregateTypes),
+		pq.Array(aggregateIDs),
+	)
+
+	if err != nil {
+		r.logger.Error("Failed to claim pending outbox messages", "error", err, "owner", owner)
+		return nil, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+
+	// Committing releases the aggregate locks along with the claimed rows
+	if err := tx.Commit(); err != nil {
+		r.logger.Error("Failed to commit outbox claim", "error", err, "owner", owner)
+		return nil, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+
+	// RETURNING does not preserve the order of the subquery
+	sort.SliceStable(messages, func(i, j int) bool {
+		if messages[i].CreatedAt.Equal(messages[j].CreatedAt) {
+			return messages[i].ID < messages[j].ID
+		}
+		return messages[i].CreatedAt.Before(messages[j].CreatedAt)
+	})
+
+	return messages, nil
+}
+
+// ReleaseMessages returns claimed messages that were not processed back to pending
+func (r *OutboxRepository) ReleaseMessages(ctx context.Context, owner string, ids []int64) error {
+	query := `
+		UPDATE outbox_messages
+		SET status = $1, processing_attempts = GREATEST(processing_attempts - 1, 0),
+			locked_by = NULL, locked_until = NULL
+		WHERE id = ANY($2) AND status = $3 AND locked_by = $4
+	`
+
+	_, err := r.db.DB.ExecContext(
+		ctx,
+		query,
+		models.OutboxStatusPending,
+		pq.Array(ids),
+		models.OutboxStatusProcessing,
+		owner,
+	)
+
+	if err != nil {
+		r.logger.Error("Failed to release outbox messages", "error", err, "owner", owner)
+		return fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+
+	return nil
+}
+
+// ReleaseExpiredLeases returns processing messages whose lease has expired back to pending
+func (r *OutboxRepository) ReleaseExpiredLeases(ctx context.Context) (int64, error) {
+	query := `
+		UPDATE outbox_messages
+		SET status = $1, locked_by = NULL, locked_until = NULL
+		WHERE status = $2 AND (locked_until IS NULL OR locked_until < $3)
+	`
+
+	result, err := r.db.DB.ExecContext(
+		ctx,
+		query,
+		models.OutboxStatusPending,
+		models.OutboxStatusProcessing,
+		time.Now().UTC(),
+	)
+
+	if err != nil {
+		r.logger.Error("Failed to release expired outbox leases", "error", err)
+		return 0, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+
+	return rowsAffected, nil
+}
+
 // MarkAsProcessing updates the status of an outbox message to processing
 func (r *OutboxRepository) MarkAsProcessing(ctx context.Context, id int64) error {
 	query := `
@@ -112,20 +356,22 @@ func (r *OutboxRepository) MarkAsProcessing(ctx context.Context, id int64) error
 	return nil
 }
 
-// MarkAsCompleted updates the status of an outbox message to completed
-func (r *OutboxRepository) MarkAsCompleted(ctx context.Context, id int64) error {
+// MarkAsCompleted updates the status of an outbox message claimed by owner to completed
+func (r *OutboxRepository) MarkAsCompleted(ctx context.Context, id int64, owner string) error {
 	query := `
 		UPDATE outbox_messages
-		SET status = $1, processed_at = $2
-		WHERE id = $3
+		SET status = $1, processed_at = $2, locked_by = NULL, locked_until = NULL
+		WHERE id = $3 AND status = $4 AND locked_by = $5
 	`
 
-	_, err := r.db.DB.ExecContext(
+	result, err := r.db.DB.ExecContext(
 		ctx,
 		query,
 		models.OutboxStatusCompleted,
 		time.Now().UTC(),
 		id,
+		models.OutboxStatusProcessing,
+		owner,
 	)
 
 	if err != nil {
@@ -133,23 +379,69 @@ func (r *OutboxRepository) MarkAsCompleted(ctx context.Context, id int64) error
 		return fmt.Errorf("%w: %v", ErrDatabase, err)
 	}
 
+	return leaseResult(result)
+}
+
+// leaseResult returns ErrLeaseLost if an update guarded by the owner's lease matched no rows
+func leaseResult(result sql.Result) error {
+	rowsAffected, err := result.RowsAffected()
+
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+
+	if rowsAffected == 0 {
+		return ErrLeaseLost
+	}
+
 	return nil
 }
 
-// MarkAsFailed updates the status of an outbox message to failed
-func (r *OutboxRepository) MarkAsFailed(ctx context.Context, id int64, errorMessage string) error {
+// ScheduleRetry returns a message claimed by owner to pending with the error of the
+// failed attempt, to be claimed again once nextAttemptAt has passed
+func (r *OutboxRepository) ScheduleRetry(ctx context.Context, id int64, owner string, errorMessage string, nextAttemptAt time.Time) error {
 	query := `
 		UPDATE outbox_messages
-		SET status = $1, last_error = $2
-		WHERE id = $3
+		SET status = $1, last_error = $2, next_attempt_at = $3,
+			locked_by = NULL, locked_until = NULL
+		WHERE id = $4 AND status = $5 AND locked_by = $6
 	`
 
-	_, err := r.db.DB.ExecContext(
+	result, err := r.db.DB.ExecContext(
+		ctx,
+		query,
+		models.OutboxStatusPending,
+		errorMessage,
+		nextAttemptAt,
+		id,
+		models.OutboxStatusProcessing,
+		owner,
+	)
+
+	if err != nil {
+		r.logger.Error("Failed to schedule outbox message retry", "error", err, "message_id", id)
+		return fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+
+	return leaseResult(result)
+}
+
+// MarkAsFailed updates the status of an outbox message claimed by owner to failed
+func (r *OutboxRepository) MarkAsFailed(ctx context.Context, id int64, owner string, errorMessage string) error {
+	query := `
+		UPDATE outbox_messages
+		SET status = $1, last_error = $2, locked_by = NULL, locked_until = NULL
+		WHERE id = $3 AND status = $4 AND locked_by = $5
+	`
+
+	result, err := r.db.DB.ExecContext(
 		ctx,
 		query,
 		models.OutboxStatusFailed,
 		errorMessage,
 		id,
+		models.OutboxStatusProcessing,
+		owner,
 	)
 
 	if err != nil {
@@ -157,14 +449,15 @@ func (r *OutboxRepository) MarkAsFailed(ctx context.Context, id int64, errorMess
 		return fmt.Errorf("%w: %v", ErrDatabase, err)
 	}
 
-	return nil
+	return leaseResult(result)
 }
 
 // GetMessage retrieves an outbox message by ID
 func (r *OutboxRepository) GetMessage(ctx context.Context, id int64) (*models.OutboxMessage, error) {
 	query := `
 		SELECT id, aggregate_type, aggregate_id, event_type, payload, 
-			   created_at, processed_at, processing_attempts, last_error, status
+			   created_at, processed_at, processing_attempts, last_error, status,
+			   locked_by, locked_until, next_attempt_at, correlation_id, trace_parent
 		FROM outbox_messages
 		WHERE id = $1
 	`
@@ -194,9 +487,9 @@ func (r *OutboxRepository) CreateInTx(tx *sql.Tx, message *models.OutboxMessage)
 	query := `
 		INSERT INTO outbox_messages (
 			aggregate_type, aggregate_id, event_type, payload, 
-			created_at, status
+			created_at, status, correlation_id, trace_parent
 		) VALUES (
-			$1, $2, $3, $4, $5, $6
+			$1, $2, $3, $4, $5, $6, $7, $8
 		) RETURNING id
 	`
 
@@ -210,12 +503,252 @@ func (r *OutboxRepository) CreateInTx(tx *sql.Tx, message *models.OutboxMessage)
 		message.Payload,
 		message.CreatedAt,
 		message.Status,
+		message.CorrelationID,
+		message.TraceParent,
 	).Scan(&id)
 
 	if err != nil {
 		return fmt.Errorf("failed to create outbox message in transaction: %w", err)
 	}
 
+	// Postgres delivers the notification only when the transaction commits
+	if _, err := tx.Exec(`SELECT pg_notify($1, $2)`, OutboxNotifyChannel, fmt.Sprint(id)); err != nil {
+		return fmt.Errorf("failed to notify outbox listeners in transaction: %w", err)
+	}
+
 	message.ID = id
 	return nil
-}
\ No newline at end of file
+}
+
+// ListenForMessages subscribes to notifications for newly created outbox messages
+func (r *OutboxRepository) ListenForMessages() (*pq.Listener, error) {
+	return r.db.Listen(OutboxNotifyChannel)
+}
+
+// List retrieves outbox messages matching the filter, newest first
+func (r *OutboxRepository) List(ctx context.Context, filter *OutboxFilter, limit, offset int) ([]*models.OutboxMessage, error) {
+	where, args := filter.whereClause()
+
+	query := fmt.Sprintf(`
+		SELECT id, aggregate_type, aggregate_id, event_type, payload, 
+			   created_at, processed_at, processing_attempts, last_error, status,
+			   locked_by, locked_until, next_attempt_at, correlation_id, trace_parent
+		FROM outbox_messages
+		%s
+		ORDER BY created_at DESC, id DESC
+		LIMIT $%d OFFSET $%d
+	`, where, len(args)+1, len(args)+2)
+
+	args = append(args, limit, offset)
+
+	var messages []*models.OutboxMessage
+	err := r.db.DB.SelectContext(ctx, &messages, query, args...)
+
+	if err != nil {
+		r.logger.Error("Failed to list outbox messages", "error", err, "limit", limit, "offset", offset)
+		return nil, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+
+	return messages, nil
+}
+
+// Count counts the outbox messages matching the filter
+func (r *OutboxRepository) Count(ctx context.Context, filter *OutboxFilter) (int, error) {
+	where, args := filter.whereClause()
+	query := fmt.Sprintf(`SELECT COUNT(*) FROM outbox_messages %s`, where)
+
+	var count int
+	err := r.db.DB.GetContext(ctx, &count, query, args...)
+
+	if err != nil {
+		r.logger.Error("Failed to count outbox messages", "error", err)
+		return 0, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+
+	return count, nil
+}
+
+// Purge deletes the outbox messages matching the filter. Callers are expected
+// to restrict the filter to terminal statuses.
+func (r *OutboxRepository) Purge(ctx context.Context, filter *OutboxFilter) (int64, error) {
+	where, args := filter.whereClause()
+	query := fmt.Sprintf(`DELETE FROM outbox_messages %s`, where)
+
+	result, err := r.db.DB.ExecContext(ctx, query, args...)
+
+	if err != nil {
+		r.logger.Error("Failed to purge outbox messages", "error", err)
+		return 0, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+
+	return rowsAffected, nil
+}
+
+// DeleteCompletedBefore deletes up to limit completed messages processed before cutoff
+func (r *OutboxRepository) DeleteCompletedBefore(ctx context.Context, cutoff time.Time, limit int) (int64, error) {
+	query := `
+		DELETE FROM outbox_messages
+		WHERE id IN (
+			SELECT id FROM outbox_messages
+			WHERE status = $1 AND COALESCE(processed_at, created_at) < $2
+			ORDER BY id ASC
+			LIMIT $3
+		)
+	`
+
+	result, err := r.db.DB.ExecContext(ctx, query, models.OutboxStatusCompleted, cutoff, limit)
+
+	if err != nil {
+		r.logger.Error("Failed to delete completed outbox messages", "error", err)
+		return 0, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+
+	return rowsAffected, nil
+}
+
+// ArchiveCompletedBefore moves up to limit completed messages processed before cutoff
+// into the archive table
+func (r *OutboxRepository) ArchiveCompletedBefore(ctx context.Context, cutoff time.Time, limit int) (int64, error) {
+	query := `
+		WITH moved AS (
+			DELETE FROM outbox_messages
+			WHERE id IN (
+				SELECT id FROM outbox_messages
+				WHERE status = $1 AND COALESCE(processed_at, created_at) < $2
+				ORDER BY id ASC
+				LIMIT $3
+			)
+			RETURNING id, aggregate_type, aggregate_id, event_type, payload,
+				created_at, processed_at, processing_attempts, correlation_id, trace_parent
+		)
+		INSERT INTO outbox_messages_archive (
+			id, aggregate_type, aggregate_id, event_type, payload,
+			created_at, processed_at, processing_attempts, correlation_id, trace_parent
+		)
+		SELECT id, aggregate_type, aggregate_id, event_type, payload,
+			created_at, processed_at, processing_attempts, correlation_id, trace_parent
+		FROM moved
+	`
+
+	result, err := r.db.DB.ExecContext(ctx, query, models.OutboxStatusCompleted, cutoff, limit)
+
+	if err != nil {
+		r.logger.Error("Failed to archive completed outbox messages", "error", err)
+		return 0, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+
+	return rowsAffected, nil
+}
+
+// Requeue returns a failed message to pending with a fresh set of attempts
+func (r *OutboxRepository) Requeue(ctx context.Context, id int64) error {
+	query := `
+		UPDATE outbox_messages
+		SET status = $1, processing_attempts = 0, next_attempt_at = NULL,
+			processed_at = NULL, locked_by = NULL, locked_until = NULL
+		WHERE id = $2 AND status = $3
+	`
+
+	result, err := r.db.DB.ExecContext(
+		ctx,
+		query,
+		models.OutboxStatusPending,
+		id,
+		models.OutboxStatusFailed,
+	)
+
+	if err != nil {
+		r.logger.Error("Failed to requeue outbox message", "error", err, "message_id", id)
+		return fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	r.notify(ctx, id)
+	return nil
+}
+
+// ReplayAggregate queues copies of every completed message of an aggregate, in their
+// original order, so its history is published again. Each copy gets a new event ID so
+// consumers that deduplicate on it handle it again, the original one is kept in replay_of.
+func (r *OutboxRepository) ReplayAggregate(ctx context.Context, aggregateType, aggregateID string) ([]int64, error) {
+	query := `
+		INSERT INTO outbox_messages (
+			aggregate_type, aggregate_id, event_type, payload,
+			created_at, status, correlation_id, trace_parent
+		)
+		SELECT aggregate_type, aggregate_id, event_type,
+			CASE WHEN payload ? 'event_id' THEN
+				jsonb_set(
+					jsonb_set(payload, '{replay_of}', COALESCE(payload->'replay_of', payload->'event_id')),
+					'{event_id}', to_jsonb('evt-' || left(gen_random_uuid()::text, 8))
+				)
+			ELSE payload END,
+			$1, $2, correlation_id, trace_parent
+		FROM outbox_messages
+		WHERE aggregate_type = $3 AND aggregate_id = $4 AND status = $5
+		ORDER BY created_at ASC, id ASC
+		RETURNING id
+	`
+
+	var ids []int64
+
+	err := r.db.DB.SelectContext(
+		ctx,
+		&ids,
+		query,
+		time.Now().UTC(),
+		models.OutboxStatusPending,
+		aggregateType,
+		aggregateID,
+		models.OutboxStatusCompleted,
+	)
+
+	if err != nil {
+		r.logger.Error("Failed to replay aggregate outbox messages", "error", err,
+			"aggregate_type", aggregateType, "aggregate_id", aggregateID)
+		return nil, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	if len(ids) > 0 {
+		r.notify(ctx, ids[0])
+	}
+
+	return ids, nil
+}
+
+// notify wakes up processors listening for new messages
+func (r *OutboxRepository) notify(ctx context.Context, id int64) {
+	if _, err := r.db.DB.ExecContext(ctx, `SELECT pg_notify($1, $2)`, OutboxNotifyChannel, fmt.Sprint(id)); err != nil {
+		// Not fatal, processors fall back to polling
+		r.logger.Warn("Failed to notify outbox listeners", "error", err, "message_id", id)
+	}
+}
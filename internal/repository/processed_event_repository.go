@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/vaidashi/fault-tolerant-api/internal/database"
+	"github.com/vaidashi/fault-tolerant-api/internal/models"
+	"github.com/vaidashi/fault-tolerant-api/pkg/logger"
+)
+
+// ProcessedEventRepository tracks the events each consumer has already applied
+type ProcessedEventRepository struct {
+	db     *database.Database
+	logger logger.Logger
+}
+
+// NewProcessedEventRepository creates a new ProcessedEventRepository
+func NewProcessedEventRepository(db *database.Database, logger logger.Logger) *ProcessedEventRepository {
+	return &ProcessedEventRepository{
+		db:     db,
+		logger: logger,
+	}
+}
+
+// BeginTx starts a new transaction
+func (r *ProcessedEventRepository) BeginTx(ctx context.Context) (*sql.Tx, error) {
+	tx, err := r.db.DB.BeginTx(ctx, nil)
+
+	if err != nil {
+		r.logger.Error("Failed to begin transaction", "error", err)
+		return nil, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	return tx, nil
+}
+
+// MarkProcessedInTx records that the consumer applied the event within a transaction,
+// returning false if the event was already processed. A concurrent delivery of the same
+// event blocks until the first transaction finishes, so only one of them is applied.
+func (r *ProcessedEventRepository) MarkProcessedInTx(tx *sql.Tx, consumer string, event *models.OutboxMessageEvent) (bool, error) {
+	query := `
+		INSERT INTO processed_events (consumer, event_id, event_type, aggregate_id, processed_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (consumer, event_id) DO NOTHING
+	`
+
+	result, err := tx.Exec(
+		query,
+		consumer,
+		event.EventID,
+		event.EventType,
+		event.AggregateID,
+		time.Now().UTC(),
+	)
+
+	if err != nil {
+		return false, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+
+	if err != nil {
+		return false, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+
+	return rowsAffected == 1, nil
+}
@@ -7,11 +7,18 @@ import (
 	"errors"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 	"github.com/vaidashi/fault-tolerant-api/internal/models"
 	"github.com/vaidashi/fault-tolerant-api/pkg/logger"
 	"github.com/vaidashi/fault-tolerant-api/internal/database"
 )
 
+// ErrShipmentExists is returned when an order already has a shipment that hasn't failed
+var ErrShipmentExists = errors.New("order already has an active shipment")
+
+// uniqueViolation is the Postgres error code for a unique constraint violation
+const uniqueViolation = "23505"
+
 // ShipmentRepository provides methods to interact with the shipment database
 type ShipmentRepository struct {
 	db *database.Database
@@ -46,6 +53,11 @@ func (r *ShipmentRepository) Create(ctx context.Context, shipment *models.Shipme
 	)
 
 	if err != nil {
+		var pqErr *pq.Error
+
+		if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+			return ErrShipmentExists
+		}
 		r.logger.Error("Failed to create shipment", "error", err, "shipmentID", shipment.ID)
 		return fmt.Errorf("%w: %v", ErrDatabase, err)
 	}
@@ -53,6 +65,44 @@ func (r *ShipmentRepository) Create(ctx context.Context, shipment *models.Shipme
 	return nil
 }
 
+// GetActiveByOrderID retrieves the shipment of an order that hasn't failed
+func (r *ShipmentRepository) GetActiveByOrderID(ctx context.Context, orderID string) (*models.Shipment, error) {
+	query := `
+		SELECT id, order_id, shipment_id, tracking_number, status, created_at, updated_at
+		FROM shipments
+		WHERE order_id = $1 AND status <> $2
+		ORDER BY created_at DESC
+		LIMIT 1
+	`
+
+	var shipment models.Shipment
+	err := r.db.DB.GetContext(ctx, &shipment, query, orderID, string(models.ShipmentStatusFailed))
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		r.logger.Error("Failed to get active shipment", "error", err, "orderID", orderID)
+		return nil, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+
+	return &shipment, nil
+}
+
+// CountFailedByOrderID counts the failed shipments of an order
+func (r *ShipmentRepository) CountFailedByOrderID(ctx context.Context, orderID string) (int, error) {
+	query := `SELECT COUNT(*) FROM shipments WHERE order_id = $1 AND status = $2`
+
+	var count int
+
+	if err := r.db.DB.GetContext(ctx, &count, query, orderID, string(models.ShipmentStatusFailed)); err != nil {
+		r.logger.Error("Failed to count failed shipments", "error", err, "orderID", orderID)
+		return 0, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+
+	return count, nil
+}
+
 // GetByID retrieves a shipment by its ID
 func (r *ShipmentRepository) GetByID(ctx context.Context, id string) (*models.Shipment, error) {
 	query := `
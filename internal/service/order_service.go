@@ -13,6 +13,7 @@ import (
 type OrderService struct {
 	orderRepo  *repository.OrderRepository
 	outboxRepo *repository.OutboxRepository
+	stateMachine *OrderStateMachine
 	logger     logger.Logger
 }
 
@@ -20,23 +21,34 @@ type OrderService struct {
 func NewOrderService(
 	orderRepo *repository.OrderRepository, 
 	outboxRepo *repository.OutboxRepository, 
+	stateMachine *OrderStateMachine,
 	logger logger.Logger,
 ) *OrderService {
 	return &OrderService{
 		orderRepo:  orderRepo,
 		outboxRepo: outboxRepo,
+		stateMachine: stateMachine,
 		logger:     logger,
 	}
 }
 
-// CreateOrder creates a new order and publishes an outbox message
+// CreateOrder creates a new order for the given items and publishes an outbox message
 func (s *OrderService) CreateOrder(
 	ctx context.Context,
 	customerID string,
-	amount float64,
+	items []models.OrderItem,
+	address *models.ShippingAddress,
 	description string,
  ) (*models.Order, error) {
-	order := models.NewOrder(customerID, amount, description)
+	if err := models.ValidateOrderItems(items); err != nil {
+		return nil, err
+	}
+
+	if err := address.Validate(); err != nil {
+		return nil, err
+	}
+
+	order := models.NewOrder(customerID, items, address, description)
 
 	outboxMsg, err := models.NewOrderCreatedEvent(order)
 
@@ -45,6 +57,8 @@ func (s *OrderService) CreateOrder(
 		return nil, fmt.Errorf("failed to create outbox message: %w", err)
 	}
 
+	outboxMsg.SetTraceContext(ctx)
+
 	// Begin transaction
 	tx, err := s.orderRepo.BeginTx(ctx)
 
@@ -81,9 +95,10 @@ func (s *OrderService) CreateOrder(
 	return order, nil
  }
 
- // UpdateOrderStatus updates an order's status and adds an outbox message in a transaction
-func (s *OrderService) UpdateOrderStatus(ctx context.Context, orderID, newStatus string) (*models.Order, error) {
-    order, err := s.orderRepo.GetByID(ctx, orderID)
+ // UpdateOrderStatus updates an order's status and adds an outbox message in a transaction,
+ // a non-zero expectedVersion must match the order's current version
+func (s *OrderService) UpdateOrderStatus(ctx context.Context, orderID, newStatus string, expectedVersion int) (*models.Order, error) {
+    order, err := s.getOrderAtVersion(ctx, orderID, expectedVersion)
 
     if err != nil {
         return nil, err
@@ -95,14 +110,9 @@ func (s *OrderService) UpdateOrderStatus(ctx context.Context, orderID, newStatus
     }
 
     oldStatus := order.Status
-    order.Status = newStatus
-
-    // Create outbox message
-    outboxMsg, err := models.NewOrderStatusChangedEvent(order, oldStatus)
 
-    if err != nil {
-        s.logger.Error("Failed to create outbox message", "error", err)
-        return nil, fmt.Errorf("failed to create outbox message: %w", err)
+    if err := s.stateMachine.Transition(ctx, order, models.OrderStatus(newStatus)); err != nil {
+        return nil, err
     }
 
     // Begin transaction
@@ -126,6 +136,16 @@ func (s *OrderService) UpdateOrderStatus(ctx context.Context, orderID, newStatus
         return nil, err
     }
 
+    // Create outbox message once the order carries its new version
+    var outboxMsg *models.OutboxMessage
+
+    if outboxMsg, err = models.NewOrderStatusChangedEvent(order, oldStatus); err != nil {
+        s.logger.Error("Failed to create outbox message", "error", err)
+        return nil, fmt.Errorf("failed to create outbox message: %w", err)
+    }
+
+    outboxMsg.SetTraceContext(ctx)
+
     // Create outbox message in transaction
     if err = s.outboxRepo.CreateInTx(tx, outboxMsg); err != nil {
         return nil, err
@@ -146,6 +166,22 @@ func (s *OrderService) UpdateOrderStatus(ctx context.Context, orderID, newStatus
     return order, nil
 }
 
+// getOrderAtVersion retrieves an order, failing with ErrVersionConflict if a
+// non-zero expectedVersion doesn't match its current version
+func (s *OrderService) getOrderAtVersion(ctx context.Context, orderID string, expectedVersion int) (*models.Order, error) {
+    order, err := s.orderRepo.GetByID(ctx, orderID)
+
+    if err != nil {
+        return nil, err
+    }
+
+    if expectedVersion != 0 && order.Version != expectedVersion {
+        return nil, repository.ErrVersionConflict
+    }
+
+    return order, nil
+}
+
 // GetOrder retrieves an order by ID
 func (s *OrderService) GetOrder(ctx context.Context, id string) (*models.Order, error) {
     return s.orderRepo.GetByID(ctx, id)
@@ -161,9 +197,10 @@ func (s *OrderService) CountOrders(ctx context.Context) (int, error) {
     return s.orderRepo.Count(ctx)
 }
 
-// UpdateOrder updates an order's details and adds an outbox message in a transaction
-func (s *OrderService) UpdateOrder(ctx context.Context, orderID string, customerID string, amount float64, description string) (*models.Order, error) {
-    order, err := s.orderRepo.GetByID(ctx, orderID)
+// UpdateOrder updates an order's details and adds an outbox message in a transaction,
+// a non-zero expectedVersion must match the order's current version
+func (s *OrderService) UpdateOrder(ctx context.Context, orderID string, customerID string, amount float64, description string, expectedVersion int) (*models.Order, error) {
+    order, err := s.getOrderAtVersion(ctx, orderID, expectedVersion)
 
     if err != nil {
         return nil, err
@@ -173,24 +210,20 @@ func (s *OrderService) UpdateOrder(ctx context.Context, orderID string, customer
     if customerID != "" {
         order.CustomerID = customerID
     }
-    if amount > 0 {
+    if amount > 0 && amount != order.Amount {
+        // The amount of an order with line items is their total
+        if len(order.Items) > 0 {
+            return nil, fmt.Errorf("%w: amount is computed from the order items", models.ErrInvalidOrder)
+        }
         order.Amount = amount
     }
     if description != "" {
         order.Description = description
     }
 
-    // Create outbox message
-    outboxMsg, err := models.NewOrderUpdatedEvent(order)
-
-    if err != nil {
-        s.logger.Error("Failed to create outbox message", "error", err)
-        return nil, fmt.Errorf("failed to create outbox message: %w", err)
-    }
-
     // Begin transaction
     tx, err := s.orderRepo.BeginTx(ctx)
-	
+
     if err != nil {
         return nil, err
     }
@@ -209,6 +242,16 @@ func (s *OrderService) UpdateOrder(ctx context.Context, orderID string, customer
         return nil, err
     }
 
+    // Create outbox message once the order carries its new version
+    var outboxMsg *models.OutboxMessage
+
+    if outboxMsg, err = models.NewOrderUpdatedEvent(order); err != nil {
+        s.logger.Error("Failed to create outbox message", "error", err)
+        return nil, fmt.Errorf("failed to create outbox message: %w", err)
+    }
+
+    outboxMsg.SetTraceContext(ctx)
+
     // Create outbox message in transaction
     if err = s.outboxRepo.CreateInTx(tx, outboxMsg); err != nil {
         return nil, err
@@ -224,7 +267,7 @@ func (s *OrderService) UpdateOrder(ctx context.Context, orderID string, customer
     return order, nil
 }
 
-// DeleteOrder deletes an order
-func (s *OrderService) DeleteOrder(ctx context.Context, id string) error {
-    return s.orderRepo.Delete(ctx, id)
+// DeleteOrder deletes an order, a non-zero expectedVersion must match the order's current version
+func (s *OrderService) DeleteOrder(ctx context.Context, id string, expectedVersion int) error {
+    return s.orderRepo.Delete(ctx, id, expectedVersion)
 }
\ No newline at end of file
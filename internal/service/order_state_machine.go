@@ -0,0 +1,96 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/vaidashi/fault-tolerant-api/internal/models"
+)
+
+var (
+	// ErrInvalidOrderStatus is returned for a status that isn't part of the order lifecycle
+	ErrInvalidOrderStatus = errors.New("invalid order status")
+	// ErrIllegalTransition is returned when an order can't move to the requested status
+	ErrIllegalTransition = errors.New("illegal order status transition")
+	// ErrTransitionGuardFailed is returned when a guard couldn't check a transition
+	ErrTransitionGuardFailed = errors.New("order transition guard failed")
+)
+
+// TransitionGuard checks whether an order may move to a status. It vetoes the move by
+// returning an error wrapping ErrIllegalTransition, any other error means it couldn't decide.
+type TransitionGuard func(ctx context.Context, order *models.Order, to models.OrderStatus) error
+
+// orderTransition identifies an edge of the order state machine
+type orderTransition struct {
+	from models.OrderStatus
+	to   models.OrderStatus
+}
+
+// OrderStateMachine validates order status changes against models.OrderTransitions
+// and the guards registered for each transition
+type OrderStateMachine struct {
+	mu     sync.RWMutex
+	guards map[orderTransition][]TransitionGuard
+}
+
+// NewOrderStateMachine creates a new OrderStateMachine
+func NewOrderStateMachine() *OrderStateMachine {
+	return &OrderStateMachine{
+		guards: make(map[orderTransition][]TransitionGuard),
+	}
+}
+
+// AddGuard registers a guard that runs before an order moves from one status to another
+func (m *OrderStateMachine) AddGuard(from, to models.OrderStatus, guard TransitionGuard) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := orderTransition{from: from, to: to}
+	m.guards[key] = append(m.guards[key], guard)
+}
+
+// CheckTransition checks the transition table for a move of the order to the given
+// status without running the guards, so callers can refuse work up front for moves
+// whose guards only pass once that work is done
+func (m *OrderStateMachine) CheckTransition(order *models.Order, to models.OrderStatus) error {
+	if !to.IsValid() {
+		return fmt.Errorf("%w: %s", ErrInvalidOrderStatus, to)
+	}
+
+	from := models.OrderStatus(order.Status)
+
+	if !from.CanTransitionTo(to) {
+		return fmt.Errorf("%w: cannot move order from %s to %s", ErrIllegalTransition, from, to)
+	}
+
+	return nil
+}
+
+// Transition moves the order to the given status if the transition is allowed
+// and no guard vetoes it, the order is left unchanged otherwise
+func (m *OrderStateMachine) Transition(ctx context.Context, order *models.Order, to models.OrderStatus) error {
+	if err := m.CheckTransition(order, to); err != nil {
+		return err
+	}
+
+	from := models.OrderStatus(order.Status)
+
+	m.mu.RLock()
+	guards := m.guards[orderTransition{from: from, to: to}]
+	m.mu.RUnlock()
+
+	for _, guard := range guards {
+		if err := guard(ctx, order, to); err != nil {
+			if errors.Is(err, ErrIllegalTransition) {
+				return fmt.Errorf("cannot move order from %s to %s: %w", from, to, err)
+			}
+			// The guard couldn't decide, fail the move without blaming the request
+			return fmt.Errorf("%w: moving order from %s to %s: %v", ErrTransitionGuardFailed, from, to, err)
+		}
+	}
+
+	order.Status = string(to)
+	return nil
+}
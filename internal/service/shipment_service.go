@@ -2,6 +2,7 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
 	"github.com/vaidashi/fault-tolerant-api/internal/models"
@@ -10,12 +11,16 @@ import (
 	"github.com/vaidashi/fault-tolerant-api/internal/clients"
 )
 
+// ErrOrderNotShippable is returned when an order lacks the details needed to ship it
+var ErrOrderNotShippable = errors.New("order cannot be shipped")
+
 // ShipmentService provides methods to manage shipments
 type ShipmentService struct {
 	shipmentRepo *repository.ShipmentRepository
 	orderRepo  *repository.OrderRepository
 	outboxRepo *repository.OutboxRepository
 	warehouseClient *clients.WarehouseClient
+	stateMachine *OrderStateMachine
 	logger logger.Logger
 }
 
@@ -25,46 +30,102 @@ func NewShipmentService(
 	orderRepo *repository.OrderRepository,
 	outboxRepo *repository.OutboxRepository,
 	warehouseClient *clients.WarehouseClient,
+	stateMachine *OrderStateMachine,
 	logger logger.Logger,
 ) *ShipmentService {
-	return &ShipmentService{
+	s := &ShipmentService{
 		shipmentRepo: shipmentRepo,
 		orderRepo: orderRepo,
 		outboxRepo: outboxRepo,
 		warehouseClient: warehouseClient,
+		stateMachine: stateMachine,
 		logger: logger,
 	}
+
+	// Orders can only be marked shipped once the warehouse has a shipment for them
+	stateMachine.AddGuard(models.OrderStatusApproved, models.OrderStatusShipped, s.requireShipment)
+
+	return s
+}
+
+// requireShipment is a transition guard vetoing orders without an active shipment
+func (s *ShipmentService) requireShipment(ctx context.Context, order *models.Order, to models.OrderStatus) error {
+	_, err := s.shipmentRepo.GetActiveByOrderID(ctx, order.ID)
+
+	if errors.Is(err, repository.ErrNotFound) {
+		return fmt.Errorf("%w: order %s has no shipment", ErrIllegalTransition, order.ID)
+	}
+
+	return err
 }
 
-// CreateShipmentForOrder creates a shipment for a given order
-func (s *ShipmentService) CreateShipmentForOrder(ctx context.Context, orderID string) (*models.Shipment, error) {
+// CreateShipmentForOrder creates a shipment for a given order, an order gets at
+// most one shipment so if it already has one that shipment is returned with created false
+func (s *ShipmentService) CreateShipmentForOrder(ctx context.Context, orderID string) (*models.Shipment, bool, error) {
 	order, err := s.orderRepo.GetByID(ctx, orderID)
 
 	if err != nil {
-		return nil, fmt.Errorf("failed to get order: %w", err)
+		return nil, false, fmt.Errorf("failed to get order: %w", err)
+	}
+
+	existing, err := s.shipmentRepo.GetActiveByOrderID(ctx, order.ID)
+
+	if err == nil {
+		s.logger.Info("Order already has a shipment", "orderID", order.ID, "shipmentID", existing.ID)
+
+		// A previous request may have failed before moving the order along
+		if models.OrderStatus(order.Status).CanTransitionTo(models.OrderStatusShipped) {
+			if err := s.advanceOrder(ctx, order.ID, models.OrderStatusShipped); err != nil {
+				return nil, false, err
+			}
+		}
+		return existing, false, nil
+	}
+
+	if !errors.Is(err, repository.ErrNotFound) {
+		return nil, false, fmt.Errorf("failed to check existing shipment: %w", err)
+	}
+
+	// Don't ask the warehouse to ship an order that can't be marked shipped, the
+	// shipment guard itself only passes once the shipment exists
+	if err := s.stateMachine.CheckTransition(order, models.OrderStatusShipped); err != nil {
+		return nil, false, err
+	}
+
+	// Failed shipments start a new attempt, retries within one attempt share its key
+	attempt, err := s.shipmentRepo.CountFailedByOrderID(ctx, order.ID)
+
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to count failed shipments: %w", err)
+	}
+
+	// Orders created before line items existed have nothing to ship
+	if len(order.Items) == 0 || order.ShippingAddress == nil {
+		return nil, false, fmt.Errorf("%w: order %s has no items or shipping address", ErrOrderNotShippable, order.ID)
+	}
+
+	products := make([]clients.ShipmentProduct, len(order.Items))
+
+	for i, item := range order.Items {
+		products[i] = clients.ShipmentProduct{
+			ProductID: item.ProductID,
+			Quantity:  item.Quantity,
+		}
 	}
 
-	// Simplified shipment creation logic
 	shipmentReq := &clients.ShipmentRequest{
 		OrderID: order.ID,
 		CustomerID: order.CustomerID,
-		Products: []struct {
-			ProductID string `json:"product_id"`
-			Quantity  int    `json:"quantity"`
-		}{
-			{
-				ProductID: "prod-sample",
-				Quantity:  1,
-			},
-		},
-		ShippingAddress: "123 Main St, Anytown, USA",
+		Products: products,
+		ShippingAddress: order.ShippingAddress.String(),
+		IdempotencyKey: clients.ShipmentIdempotencyKey(order.ID, attempt),
 	}
 
 	shipmentResp, err := s.warehouseClient.CreateShipment(ctx, shipmentReq)
 
 	if err != nil {
 		s.logger.Error("Failed to create shipment in warehouse", "error", err, "orderID", order.ID)
-		return nil, fmt.Errorf("failed to create shipment: %w", err)
+		return nil, false, fmt.Errorf("failed to create shipment: %w", err)
 	}
 
 		// Create a shipment record in our database
@@ -77,55 +138,113 @@ func (s *ShipmentService) CreateShipmentForOrder(ctx context.Context, orderID st
 
 	// Save the shipment
 	if err := s.shipmentRepo.Create(ctx, shipment); err != nil {
+		// A concurrent request for the same order won, the warehouse saw the
+		// same idempotency key so both refer to the same shipment
+		if errors.Is(err, repository.ErrShipmentExists) {
+			existing, getErr := s.shipmentRepo.GetActiveByOrderID(ctx, order.ID)
+
+			if getErr != nil {
+				return nil, false, fmt.Errorf("failed to get existing shipment: %w", getErr)
+			}
+
+			if err := s.advanceOrder(ctx, order.ID, models.OrderStatusShipped); err != nil {
+				return nil, false, err
+			}
+			return existing, false, nil
+		}
 		s.logger.Error("Failed to save shipment", "error", err, "shipmentID", shipment.ID)
-		return nil, fmt.Errorf("failed to save shipment: %w", err)
+		return nil, false, fmt.Errorf("failed to save shipment: %w", err)
 	}
 
-	// Update the order status if needed 
-	if order.Status == string(models.OrderStatusApproved) {
-		oldStatus := order.Status
-		order.Status = string(models.OrderStatusShipped)
+	// Update the order status if needed
+	if err := s.advanceOrder(ctx, order.ID, models.OrderStatusShipped); err != nil {
+		return nil, false, err
+	}
+
+	return shipment, true, nil
+}
+
+// maxOrderUpdateAttempts bounds how often advanceOrder retries on version conflicts
+const maxOrderUpdateAttempts = 3
 
-		// Begin transaction
-		tx, err := s.orderRepo.BeginTx(ctx)
+// advanceOrder moves an order to the given status through the state machine and
+// records the change in the outbox. The order is re-read and the move retried when
+// it was updated concurrently. Orders already in that status are left alone, moves
+// the state machine rejects fail with ErrIllegalTransition.
+func (s *ShipmentService) advanceOrder(ctx context.Context, orderID string, to models.OrderStatus) error {
+	for attempt := 1; ; attempt++ {
+		order, err := s.orderRepo.GetByID(ctx, orderID)
 
 		if err != nil {
-			return nil, err
+			return fmt.Errorf("failed to get order: %w", err)
 		}
 
-		// Rollback transaction if any error occurs
-		defer func() {
-			if err != nil {
-				if rbErr := tx.Rollback(); rbErr != nil {
-					s.logger.Error("Failed to rollback transaction", "error", rbErr, "orderID", order.ID)
-				}
-			}
-		}()
-
-		// Update order status in transaction
-		if err = s.orderRepo.UpdateInTx(tx, order); err != nil {
-			return nil, err
+		if order.Status == string(to) {
+			return nil
 		}
 
-		// Create outbox message for status change
-		outboxMsg, err := models.NewOrderStatusChangedEvent(order, oldStatus)
-		if err != nil {
-			return nil, err
+		oldStatus := order.Status
+
+		if err := s.stateMachine.Transition(ctx, order, to); err != nil {
+			s.logger.Warn("Order status change rejected", "error", err, "orderID", orderID, "to", to)
+			return err
 		}
-		
-		// Create outbox message in transaction
-		if err = s.outboxRepo.CreateInTx(tx, outboxMsg); err != nil {
-			return nil, err
+
+		err = s.updateOrderStatusInTx(ctx, order, oldStatus)
+
+		if !errors.Is(err, repository.ErrVersionConflict) || attempt == maxOrderUpdateAttempts {
+			return err
 		}
-		
-		// Commit transaction
-		if err = tx.Commit(); err != nil {
-			s.logger.Error("Failed to commit transaction", "error", err)
-			return nil, fmt.Errorf("failed to commit transaction: %w", err)
+
+		s.logger.Info("Order changed concurrently, retrying status change", "orderID", orderID, "attempt", attempt)
+	}
+}
+
+// updateOrderStatusInTx saves an order whose status changed from oldStatus along
+// with its status changed event
+func (s *ShipmentService) updateOrderStatusInTx(ctx context.Context, order *models.Order, oldStatus string) (err error) {
+	// Begin transaction
+	tx, err := s.orderRepo.BeginTx(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	// Rollback transaction if any error occurs
+	defer func() {
+		if err != nil {
+			if rbErr := tx.Rollback(); rbErr != nil {
+				s.logger.Error("Failed to rollback transaction", "error", rbErr, "orderID", order.ID)
+			}
 		}
+	}()
+
+	// Update order status in transaction
+	if err = s.orderRepo.UpdateInTx(tx, order); err != nil {
+		return err
 	}
 
-	return shipment, nil
+	// Create outbox message for status change
+	var outboxMsg *models.OutboxMessage
+
+	if outboxMsg, err = models.NewOrderStatusChangedEvent(order, oldStatus); err != nil {
+		return err
+	}
+
+	outboxMsg.SetTraceContext(ctx)
+
+	// Create outbox message in transaction
+	if err = s.outboxRepo.CreateInTx(tx, outboxMsg); err != nil {
+		return err
+	}
+
+	// Commit transaction
+	if err = tx.Commit(); err != nil {
+		s.logger.Error("Failed to commit transaction", "error", err)
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
 }
 
 // GetShipmentByID retrieves a shipment by ID
@@ -163,6 +282,9 @@ func (s *ShipmentService) UpdateShipmentStatus(ctx context.Context, id string) (
 		newStatus = string(models.ShipmentStatusShipped)
 	case "DELIVERED":
 		newStatus = string(models.ShipmentStatusDelivered)
+	case "FAILED", "CANCELLED", "CANCELED":
+		// A failed shipment ends its attempt, the next one gets a new idempotency key
+		newStatus = string(models.ShipmentStatusFailed)
 	default:
 		newStatus = string(models.ShipmentStatusPending)
 	}
@@ -175,57 +297,14 @@ func (s *ShipmentService) UpdateShipmentStatus(ctx context.Context, id string) (
 		}
 		
 		shipment.Status = newStatus
-		
-		// If shipment is delivered, update order status
-		if newStatus == string(models.ShipmentStatusDelivered) {
-			// Get the order
-			order, err := s.orderRepo.GetByID(ctx, shipment.OrderID)
-			
-			if err != nil {
-				s.logger.Error("Failed to get order for delivered shipment", "error", err, "orderID", shipment.OrderID)
-				// Continue anyway, don't fail the whole operation
-			} else if order.Status != string(models.OrderStatusDelivered) {
-				oldStatus := order.Status
-				order.Status = string(models.OrderStatusDelivered)
-				
-				// Begin transaction
-				tx, err := s.orderRepo.BeginTx(ctx)
-				
-				if err != nil {
-					return nil, err
-				}
-				
-				// Rollback transaction in case of error
-				defer func() {
-					if err != nil {
-						if rbErr := tx.Rollback(); rbErr != nil {
-							s.logger.Error("Failed to rollback transaction", "error", rbErr)
-						}
-					}
-				}()
-				
-				// Update order in transaction
-				if err = s.orderRepo.UpdateInTx(tx, order); err != nil {
-					return nil, err
-				}
-				
-				// Create outbox message for status change
-				outboxMsg, err := models.NewOrderStatusChangedEvent(order, oldStatus)
-				if err != nil {
-					return nil, err
-				}
-				
-				// Create outbox message in transaction
-				if err = s.outboxRepo.CreateInTx(tx, outboxMsg); err != nil {
-					return nil, err
-				}
-				
-				// Commit transaction
-				if err = tx.Commit(); err != nil {
-					s.logger.Error("Failed to commit transaction", "error", err)
-					return nil, fmt.Errorf("failed to commit transaction: %w", err)
-				}
-			}
+	}
+
+	// If shipment is delivered, update order status, checked on every sync so
+	// a failed update is picked up again
+	if shipment.Status == string(models.ShipmentStatusDelivered) {
+		if err := s.advanceOrder(ctx, shipment.OrderID, models.OrderStatusDelivered); err != nil {
+			s.logger.Error("Failed to mark order as delivered", "error", err, "orderID", shipment.OrderID)
+			return nil, err
 		}
 	}
 	
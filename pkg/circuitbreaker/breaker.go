@@ -15,38 +15,204 @@ const (
 	StateOpen                   // Circuit is open, requests are not allowed
 )
 
+// String returns the string representation of the state
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateHalfOpen:
+		return "half-open"
+	case StateOpen:
+		return "open"
+	default:
+		return "unknown"
+	}
+}
+
+// Mode selects how a closed circuit decides to trip
+type Mode int
+
+const (
+	ModeConsecutiveFailures Mode = iota // Trip after FailureThreshold consecutive failures
+	ModeSlidingWindow                   // Trip on failure or slow-call rate over a rolling window
+)
+
+// String returns the string representation of the mode
+func (m Mode) String() string {
+	switch m {
+	case ModeConsecutiveFailures:
+		return "consecutive-failures"
+	case ModeSlidingWindow:
+		return "sliding-window"
+	default:
+		return "unknown"
+	}
+}
+
+// WindowType selects how a sliding window is bounded
+type WindowType int
+
+const (
+	WindowTypeCount WindowType = iota // Last WindowSize calls
+	WindowTypeTime                    // Calls made during the last WindowDuration
+)
+
+// Default sliding window settings
+const (
+	defaultWindowSize           = 100
+	defaultWindowDuration       = 60 * time.Second
+	defaultMinimumRequests      = 10
+	defaultFailureRateThreshold = 50
+)
+
+// StateChangeFunc is called whenever a circuit breaker changes state
+type StateChangeFunc func(name string, from, to State)
+
 // CircuitBreaker implements the circuit breaker pattern
 type CircuitBreaker struct {
+	name            string
 	state           int32 // Using atomic operations
+	forcedOpen      int32 // Set when the circuit was opened manually
+	mode            Mode
 	failureThreshold int64
 	resetTimeout    time.Duration
 	halfOpenMaxCalls int64
+	window          slidingWindow
+	minimumRequests int64
+	failureRateThreshold float64
+	slowCallDurationThreshold time.Duration
+	slowCallRateThreshold float64
 	failureCount    int64
 	halfOpenCalls   int64
 	lastStateChange time.Time
+	onStateChange   []StateChangeFunc
 	mutex           sync.RWMutex
 }
 
 // CircuitBreakerConfig configures a CircuitBreaker
 type CircuitBreakerConfig struct {
-	FailureThreshold int64
+	Mode             Mode
+	FailureThreshold int64 // Consecutive failures before tripping, for ModeConsecutiveFailures
 	ResetTimeout     time.Duration
 	HalfOpenMaxCalls int64
+
+	// Sliding window settings, for ModeSlidingWindow
+	WindowType                WindowType
+	WindowSize                int           // Number of calls in a count-based window
+	WindowDuration            time.Duration // Length of a time-based window
+	MinimumRequests           int64         // Calls required in the window before the rates are evaluated
+	FailureRateThreshold      float64       // Failure percentage that trips the circuit
+	SlowCallDurationThreshold time.Duration // Calls slower than this count as slow, zero disables
+	SlowCallRateThreshold     float64       // Slow call percentage that trips the circuit, zero disables
 }
 
 // NewCircuitBreaker creates a new circuit breaker
 func NewCircuitBreaker(config CircuitBreakerConfig) *CircuitBreaker {
-	return &CircuitBreaker{
+	return newNamedCircuitBreaker("", config)
+}
+
+// newNamedCircuitBreaker creates a new circuit breaker with a name
+func newNamedCircuitBreaker(name string, config CircuitBreakerConfig) *CircuitBreaker {
+	cb := &CircuitBreaker{
+		name:             name,
+		mode:             config.Mode,
 		state:            int32(StateClosed),
 		failureThreshold: config.FailureThreshold,
 		resetTimeout:     config.ResetTimeout,
 		halfOpenMaxCalls: config.HalfOpenMaxCalls,
 		lastStateChange:  time.Now(),
 	}
+
+	if config.Mode == ModeSlidingWindow {
+		cb.window = newSlidingWindow(config)
+		cb.minimumRequests = config.MinimumRequests
+		cb.failureRateThreshold = config.FailureRateThreshold
+		cb.slowCallDurationThreshold = config.SlowCallDurationThreshold
+		cb.slowCallRateThreshold = config.SlowCallRateThreshold
+
+		// Set default values if not provided
+		if cb.minimumRequests <= 0 {
+			cb.minimumRequests = defaultMinimumRequests
+		}
+		if cb.failureRateThreshold <= 0 {
+			cb.failureRateThreshold = defaultFailureRateThreshold
+		}
+	}
+
+	return cb
+}
+
+// newSlidingWindow creates the window described by the config
+func newSlidingWindow(config CircuitBreakerConfig) slidingWindow {
+	if config.WindowType == WindowTypeTime {
+		duration := config.WindowDuration
+
+		if duration <= 0 {
+			duration = defaultWindowDuration
+		}
+		return newTimeWindow(duration)
+	}
+
+	size := config.WindowSize
+
+	if size <= 0 {
+		size = defaultWindowSize
+	}
+	return newCountWindow(size)
+}
+
+// Name returns the name of the circuit breaker
+func (cb *CircuitBreaker) Name() string {
+	return cb.name
+}
+
+// OnStateChange registers a callback invoked after every state transition.
+// Callbacks run synchronously on the caller's goroutine and must not block.
+func (cb *CircuitBreaker) OnStateChange(fn StateChangeFunc) {
+	cb.mutex.Lock()
+	cb.onStateChange = append(cb.onStateChange, fn)
+	cb.mutex.Unlock()
+}
+
+// transition moves the breaker from one state to another and notifies listeners
+func (cb *CircuitBreaker) transition(from, to State) bool {
+	if !atomic.CompareAndSwapInt32(&cb.state, int32(from), int32(to)) {
+		return false
+	}
+
+	// Start every closed period with an empty window
+	if to == StateClosed && cb.window != nil {
+		cb.window.reset()
+	}
+
+	cb.stateChanged(from, to)
+	return true
+}
+
+// stateChanged records the time of a transition and runs the callbacks
+func (cb *CircuitBreaker) stateChanged(from, to State) {
+	cb.mutex.Lock()
+	cb.lastStateChange = time.Now()
+	hooks := make([]StateChangeFunc, len(cb.onStateChange))
+	copy(hooks, cb.onStateChange)
+	cb.mutex.Unlock()
+
+	if from == to {
+		return
+	}
+
+	for _, hook := range hooks {
+		hook(cb.name, from, to)
+	}
 }
 
 // Allow checks if a request is allowed based on the circuit breaker state
 func (cb *CircuitBreaker) Allow() bool {
+	// A manually opened circuit stays open until it is reset
+	if atomic.LoadInt32(&cb.forcedOpen) == 1 {
+		return false
+	}
+
 	state := State(atomic.LoadInt32(&cb.state))
 
 	switch state {
@@ -60,11 +226,8 @@ func (cb *CircuitBreaker) Allow() bool {
 
 		if elaspsed >= cb.resetTimeout {
 			// Try to transition to half-open state
-			if atomic.CompareAndSwapInt32(&cb.state, int32(StateOpen), int32(StateHalfOpen)) {
-				cb.mutex.Lock()
-				cb.lastStateChange = time.Now()
+			if cb.transition(StateOpen, StateHalfOpen) {
 				atomic.StoreInt64(&cb.halfOpenCalls, 0)
-				cb.mutex.Unlock()
 			}
 			return cb.Allow() // Retry with new state
 		}
@@ -78,47 +241,86 @@ func (cb *CircuitBreaker) Allow() bool {
 	}
 }
 
-// Success reports a successful operation
-func (cb *CircuitBreaker) Success() {
-	state := State(atomic.LoadInt32(&cb.state))
+// Release gives back a call allowed by Allow without recording an outcome, so
+// an abandoned half-open probe doesn't hold its slot forever
+func (cb *CircuitBreaker) Release() {
+	if State(atomic.LoadInt32(&cb.state)) != StateHalfOpen {
+		return
+	}
 
-	if state == StateHalfOpen {
-		// If in half-open state and successful, transition to closed state
-		if atomic.CompareAndSwapInt32(&cb.state, int32(StateHalfOpen), int32(StateClosed)) {
-			cb.mutex.Lock()
-			cb.lastStateChange = time.Now()
-			atomic.StoreInt64(&cb.failureCount, 0)
-			cb.mutex.Unlock()
-		} else if state == StateClosed {
-			// Reset failure count if in closed state
-			atomic.StoreInt64(&cb.failureCount, 0)
+	for {
+		calls := atomic.LoadInt64(&cb.halfOpenCalls)
+
+		if calls <= 0 || atomic.CompareAndSwapInt64(&cb.halfOpenCalls, calls, calls-1) {
+			return
 		}
 	}
 }
 
+// Success reports a successful operation
+func (cb *CircuitBreaker) Success() {
+	cb.RecordResult(true, 0)
+}
+
 // Failure reports a failed operation
 func (cb *CircuitBreaker) Failure() {
+	cb.RecordResult(false, 0)
+}
+
+// RecordResult reports the outcome and duration of an operation
+func (cb *CircuitBreaker) RecordResult(success bool, duration time.Duration) {
 	state := State(atomic.LoadInt32(&cb.state))
 
-	if state == StateClosed {
+	switch state {
+	case StateClosed:
+		if cb.mode == ModeSlidingWindow {
+			cb.recordInWindow(success, duration)
+			return
+		}
+
+		if success {
+			// Only consecutive failures count towards the threshold
+			atomic.StoreInt64(&cb.failureCount, 0)
+			return
+		}
+
 		// Increment failure count
 		failureCount := atomic.AddInt64(&cb.failureCount, 1)
 
 		if failureCount >= cb.failureThreshold {
 			// Transition to open state if threshold is reached
-			if atomic.CompareAndSwapInt32(&cb.state, int32(StateClosed), int32(StateOpen)) {
-				cb.mutex.Lock()
-				cb.lastStateChange = time.Now()
-				cb.mutex.Unlock()
+			cb.transition(StateClosed, StateOpen)
+		}
+	case StateHalfOpen:
+		if success {
+			// If in half-open state and successful, transition to closed state
+			if cb.transition(StateHalfOpen, StateClosed) {
+				atomic.StoreInt64(&cb.failureCount, 0)
 			}
+			return
 		}
-	} else if state == StateHalfOpen {
+
 		// In half-open state, treat as a failure and transition to open state
-		if atomic.CompareAndSwapInt32(&cb.state, int32(StateHalfOpen), int32(StateOpen)) {
-			cb.mutex.Lock()
-			cb.lastStateChange = time.Now()
-			cb.mutex.Unlock()
-		}
+		cb.transition(StateHalfOpen, StateOpen)
+	}
+}
+
+// recordInWindow adds an outcome to the sliding window and trips the circuit
+// when the failure or slow-call rate crosses its threshold
+func (cb *CircuitBreaker) recordInWindow(success bool, duration time.Duration) {
+	slow := cb.slowCallDurationThreshold > 0 && duration >= cb.slowCallDurationThreshold
+
+	snapshot := cb.window.record(windowOutcome{failed: !success, slow: slow})
+
+	if snapshot.total < cb.minimumRequests {
+		return
+	}
+
+	tripped := snapshot.failureRate() >= cb.failureRateThreshold ||
+		(cb.slowCallRateThreshold > 0 && snapshot.slowCallRate() >= cb.slowCallRateThreshold)
+
+	if tripped {
+		cb.transition(StateClosed, StateOpen)
 	}
 }
 
@@ -129,13 +331,24 @@ func (cb *CircuitBreaker) GetState() State {
 
 // Reset resets the circuit breaker to closed state
 func (cb *CircuitBreaker) Reset() {
-	atomic.StoreInt32(&cb.state, int32(StateClosed))
+	atomic.StoreInt32(&cb.forcedOpen, 0)
+	from := State(atomic.SwapInt32(&cb.state, int32(StateClosed)))
 	atomic.StoreInt64(&cb.failureCount, 0)
 	atomic.StoreInt64(&cb.halfOpenCalls, 0)
-	
-	cb.mutex.Lock()
-	cb.lastStateChange = time.Now()
-	cb.mutex.Unlock()
+
+	if cb.window != nil {
+		cb.window.reset()
+	}
+
+	cb.stateChanged(from, StateClosed)
+}
+
+// ForceOpen opens the circuit and keeps it open until Reset is called
+func (cb *CircuitBreaker) ForceOpen() {
+	atomic.StoreInt32(&cb.forcedOpen, 1)
+	from := State(atomic.SwapInt32(&cb.state, int32(StateOpen)))
+
+	cb.stateChanged(from, StateOpen)
 }
 
 // GetMetrics returns metrics about the circuit breaker
@@ -146,19 +359,11 @@ func (cb *CircuitBreaker) GetMetrics() map[string]interface{} {
 	lastChange := cb.lastStateChange
 	cb.mutex.RUnlock()
 	
-	var stateStr string
-
-	switch state {
-	case StateClosed:
-		stateStr = "closed"
-	case StateHalfOpen:
-		stateStr = "half-open"
-	case StateOpen:
-		stateStr = "open"
-	}
-	
-	return map[string]interface{}{
-		"state":             stateStr,
+	metrics := map[string]interface{}{
+		"name":              cb.name,
+		"mode":              cb.mode.String(),
+		"state":             state.String(),
+		"forced_open":       atomic.LoadInt32(&cb.forcedOpen) == 1,
 		"failure_count":     atomic.LoadInt64(&cb.failureCount),
 		"failure_threshold": cb.failureThreshold,
 		"half_open_calls":   atomic.LoadInt64(&cb.halfOpenCalls),
@@ -166,4 +371,18 @@ func (cb *CircuitBreaker) GetMetrics() map[string]interface{} {
 		"last_state_change": lastChange,
 		"time_in_state":     time.Since(lastChange).String(),
 	}
-}
\ No newline at end of file
+
+	if cb.window != nil {
+		snapshot := cb.window.snapshot()
+		metrics["window_requests"] = snapshot.total
+		metrics["window_failures"] = snapshot.failures
+		metrics["window_slow_calls"] = snapshot.slow
+		metrics["failure_rate"] = snapshot.failureRate()
+		metrics["failure_rate_threshold"] = cb.failureRateThreshold
+		metrics["slow_call_rate"] = snapshot.slowCallRate()
+		metrics["slow_call_rate_threshold"] = cb.slowCallRateThreshold
+		metrics["minimum_requests"] = cb.minimumRequests
+	}
+
+	return metrics
+}
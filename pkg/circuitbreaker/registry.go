@@ -0,0 +1,91 @@
+package circuitbreaker
+
+import (
+	"sort"
+	"sync"
+)
+
+// Registry keeps track of named circuit breakers
+type Registry struct {
+	breakers      map[string]*CircuitBreaker
+	onStateChange []StateChangeFunc
+	mutex         sync.RWMutex
+}
+
+// NewRegistry creates a new circuit breaker registry
+func NewRegistry() *Registry {
+	return &Registry{
+		breakers: make(map[string]*CircuitBreaker),
+	}
+}
+
+// Register returns the breaker with the given name, creating it with config if it does not exist
+func (r *Registry) Register(name string, config CircuitBreakerConfig) *CircuitBreaker {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if breaker, exists := r.breakers[name]; exists {
+		return breaker
+	}
+
+	breaker := newNamedCircuitBreaker(name, config)
+
+	// Apply registry-wide callbacks to the new breaker
+	for _, hook := range r.onStateChange {
+		breaker.OnStateChange(hook)
+	}
+
+	r.breakers[name] = breaker
+	return breaker
+}
+
+// Get returns the breaker with the given name
+func (r *Registry) Get(name string) (*CircuitBreaker, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	breaker, exists := r.breakers[name]
+	return breaker, exists
+}
+
+// Names returns the names of all registered breakers in sorted order
+func (r *Registry) Names() []string {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	names := make([]string, 0, len(r.breakers))
+
+	for name := range r.breakers {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// OnStateChange registers a callback for state transitions of every breaker,
+// including breakers registered later
+func (r *Registry) OnStateChange(fn StateChangeFunc) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.onStateChange = append(r.onStateChange, fn)
+
+	for _, breaker := range r.breakers {
+		breaker.OnStateChange(fn)
+	}
+}
+
+// GetMetrics returns metrics for every registered breaker keyed by name
+func (r *Registry) GetMetrics() map[string]interface{} {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	metrics := make(map[string]interface{}, len(r.breakers))
+
+	for name, breaker := range r.breakers {
+		metrics[name] = breaker.GetMetrics()
+	}
+
+	return metrics
+}
@@ -0,0 +1,196 @@
+package circuitbreaker
+
+import (
+	"sync"
+	"time"
+)
+
+// windowOutcome is the result of a single call recorded in a sliding window
+type windowOutcome struct {
+	failed bool
+	slow   bool
+}
+
+// windowSnapshot holds the aggregated outcomes currently in a sliding window
+type windowSnapshot struct {
+	total    int64
+	failures int64
+	slow     int64
+}
+
+// failureRate returns the percentage of failed calls in the snapshot
+func (s windowSnapshot) failureRate() float64 {
+	if s.total == 0 {
+		return 0
+	}
+	return float64(s.failures) / float64(s.total) * 100
+}
+
+// slowCallRate returns the percentage of slow calls in the snapshot
+func (s windowSnapshot) slowCallRate() float64 {
+	if s.total == 0 {
+		return 0
+	}
+	return float64(s.slow) / float64(s.total) * 100
+}
+
+// slidingWindow aggregates call outcomes over a rolling window
+type slidingWindow interface {
+	record(outcome windowOutcome) windowSnapshot
+	snapshot() windowSnapshot
+	reset()
+}
+
+// countWindow keeps the outcomes of the last N calls
+type countWindow struct {
+	outcomes []windowOutcome
+	next     int
+	filled   bool
+	totals   windowSnapshot
+	mutex    sync.Mutex
+}
+
+// newCountWindow creates a window over the last size calls
+func newCountWindow(size int) *countWindow {
+	return &countWindow{
+		outcomes: make([]windowOutcome, size),
+	}
+}
+
+func (w *countWindow) record(outcome windowOutcome) windowSnapshot {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	// Evict the oldest outcome once the ring is full
+	if w.filled {
+		w.totals.subtract(w.outcomes[w.next])
+	} else {
+		w.totals.total++
+	}
+
+	if outcome.failed {
+		w.totals.failures++
+	}
+	if outcome.slow {
+		w.totals.slow++
+	}
+
+	w.outcomes[w.next] = outcome
+	w.next = (w.next + 1) % len(w.outcomes)
+
+	if w.next == 0 {
+		w.filled = true
+	}
+
+	return w.totals
+}
+
+func (w *countWindow) snapshot() windowSnapshot {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	return w.totals
+}
+
+func (w *countWindow) reset() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.outcomes = make([]windowOutcome, len(w.outcomes))
+	w.next = 0
+	w.filled = false
+	w.totals = windowSnapshot{}
+}
+
+// subtract removes an evicted outcome from the totals, the call count stays the same
+func (s *windowSnapshot) subtract(outcome windowOutcome) {
+	if outcome.failed {
+		s.failures--
+	}
+	if outcome.slow {
+		s.slow--
+	}
+}
+
+// timeBucket aggregates the outcomes recorded during one second
+type timeBucket struct {
+	epoch int64
+	windowSnapshot
+}
+
+// timeWindow keeps the outcomes of calls made during the last duration,
+// bucketed per second
+type timeWindow struct {
+	buckets []timeBucket
+	now     func() time.Time
+	mutex   sync.Mutex
+}
+
+// newTimeWindow creates a window over the calls made during the last duration
+func newTimeWindow(duration time.Duration) *timeWindow {
+	seconds := int(duration / time.Second)
+
+	if seconds < 1 {
+		seconds = 1
+	}
+
+	return &timeWindow{
+		buckets: make([]timeBucket, seconds),
+		now:     time.Now,
+	}
+}
+
+func (w *timeWindow) record(outcome windowOutcome) windowSnapshot {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	epoch := w.now().Unix()
+	bucket := &w.buckets[epoch%int64(len(w.buckets))]
+
+	// Reuse a bucket left over from a previous rotation
+	if bucket.epoch != epoch {
+		bucket.epoch = epoch
+		bucket.windowSnapshot = windowSnapshot{}
+	}
+
+	bucket.total++
+	if outcome.failed {
+		bucket.failures++
+	}
+	if outcome.slow {
+		bucket.slow++
+	}
+
+	return w.aggregate(epoch)
+}
+
+func (w *timeWindow) snapshot() windowSnapshot {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	return w.aggregate(w.now().Unix())
+}
+
+func (w *timeWindow) reset() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.buckets = make([]timeBucket, len(w.buckets))
+}
+
+// aggregate sums the buckets that still fall inside the window
+func (w *timeWindow) aggregate(epoch int64) windowSnapshot {
+	var totals windowSnapshot
+	oldest := epoch - int64(len(w.buckets)) + 1
+
+	for _, bucket := range w.buckets {
+		if bucket.epoch < oldest || bucket.epoch > epoch {
+			continue
+		}
+		totals.total += bucket.total
+		totals.failures += bucket.failures
+		totals.slow += bucket.slow
+	}
+
+	return totals
+}
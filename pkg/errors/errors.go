@@ -77,6 +77,18 @@ func IsRetryable(err error) bool {
 		errors.Is(err, ErrRateLimited)
 }
 
+// IsPermanent checks if the error is known to fail again if retried,
+// unclassified errors are not considered permanent
+func IsPermanent(err error) bool {
+	var appErr *AppError
+
+	if errors.As(err, &appErr) {
+		return !appErr.Retryable
+	}
+
+	return errors.Is(err, ErrPermanentFailure)
+}
+
 // NewNotFoundError creates a not found error
 func NewNotFoundError(message string) *AppError {
 	return NewAppError(ErrNotFound, message, http.StatusNotFound, false)
@@ -112,6 +124,16 @@ func NewTemporaryError(message string) *AppError {
 	return NewAppError(ErrTemporaryFailure, message, http.StatusServiceUnavailable, true)
 }
 
+// NewPermanentError creates an error for failures that will not succeed on retry
+func NewPermanentError(message string) *AppError {
+	return NewAppError(ErrPermanentFailure, message, http.StatusUnprocessableEntity, false)
+}
+
+// NewServiceUnavailableError creates a service unavailable error
+func NewServiceUnavailableError(message string) *AppError {
+	return NewAppError(ErrServiceUnavailable, message, http.StatusServiceUnavailable, true)
+}
+
 // NewTimeoutError creates a timeout error
 func NewTimeoutError(message string) *AppError {
 	return NewAppError(ErrTimeout, message, http.StatusGatewayTimeout, true)
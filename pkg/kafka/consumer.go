@@ -4,12 +4,16 @@ import (
 	"context"
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/Shopify/sarama"
 	"github.com/vaidashi/fault-tolerant-api/pkg/logger"
+	"github.com/vaidashi/fault-tolerant-api/pkg/tracing"
 )
 
-// MessageHandler is the interface for handling messages from Kafka
+// MessageHandler is the interface for handling messages from Kafka. The record's
+// event headers are available through Metadata, and its correlation ID and trace
+// context through the tracing package on ctx.
 type MessageHandler interface {
 	HandleMessage(ctx context.Context, msg *sarama.ConsumerMessage) error
 }
@@ -19,6 +23,8 @@ type Consumer struct {
 	consumerGroup sarama.ConsumerGroup
 	topics        []string
 	handlers map[string]MessageHandler
+	retryDelays   []time.Duration
+	producer      *Producer
 	logger        logger.Logger
 	wg            sync.WaitGroup
 	ctx           context.Context
@@ -30,13 +36,22 @@ type ConsumerConfig struct {
 	Brokers []string
 	Topics []string
 	ConsumerGroup string
+	// RetryDelays holds the delay of each retry tier. A failed record moves through
+	// <topic>.retry.1 to <topic>.retry.N and then to <topic>.dlt, the topics must exist.
+	RetryDelays []time.Duration
+	Producer *Producer // Republishes failed records to the retry and dead letter topics
 }
 
 // NewConsumer creates a new Kafka consumer
 func NewConsumer(cfg *ConsumerConfig, logger logger.Logger) (*Consumer, error) {
+	if cfg.Producer == nil {
+		return nil, fmt.Errorf("a producer is required to republish failed records")
+	}
+
 	saramaCfg := sarama.NewConfig()
 	saramaCfg.Consumer.Return.Errors = true
 	saramaCfg.Consumer.Offsets.Initial = sarama.OffsetOldest
+	saramaCfg.Consumer.IsolationLevel = sarama.ReadCommitted // Skip records of aborted producer transactions
 
 	consumerGroup, err := sarama.NewConsumerGroup(cfg.Brokers, cfg.ConsumerGroup, saramaCfg)
 
@@ -46,17 +61,29 @@ func NewConsumer(cfg *ConsumerConfig, logger logger.Logger) (*Consumer, error) {
 
 	ctx, cancel := context.WithCancel(context.Background())
 
+	// Retried records are consumed by the same group
+	topics := append([]string(nil), cfg.Topics...)
+
+	for _, topic := range cfg.Topics {
+		for attempt := 1; attempt <= len(cfg.RetryDelays); attempt++ {
+			topics = append(topics, RetryTopic(topic, attempt))
+		}
+	}
+
 	return &Consumer{
 		consumerGroup: consumerGroup,
-		topics: cfg.Topics,
+		topics: topics,
 		handlers: make(map[string]MessageHandler),
+		retryDelays: cfg.RetryDelays,
+		producer: cfg.Producer,
 		logger: logger,
 		ctx: ctx,
 		cancel: cancel,
 	}, nil
 }
 
-// RegisterHandler registers a message handler for a specific topic
+// RegisterHandler registers a message handler for a specific topic, the handler
+// also receives the records retried from that topic
 func (c *Consumer) RegisterHandler(topic string, handler MessageHandler) {
 	c.handlers[topic] = handler
 }
@@ -132,26 +159,10 @@ func (c *Consumer) ConsumeClaim(session sarama.ConsumerGroupSession, claim saram
 					"key", string(msg.Key))
 
 				
-				// Find the handler for the topic
-				handler, exists := c.handlers[msg.Topic]
-
-				if !exists {
-					c.logger.Warn("No handler registered for topic", "topic", msg.Topic)
-					session.MarkMessage(msg, "") // Mark the message as processed
-					continue
-				}
-
-				// Handle the message
-				if err := handler.HandleMessage(session.Context(), msg); err != nil {
-					c.logger.Error("Error handling message",
-						"error", err, 
-						"topic", msg.Topic,
-						"partition", msg.Partition,
-						"offset", msg.Offset)
-					
-					// Don't mark the message, so it will be redelivered
-					// In a production system, you'd want more sophisticated error handling
-					continue
+				if err := c.handleMessage(session.Context(), msg); err != nil {
+					// The session ended before the record was handled or republished,
+					// leave it unmarked so it is redelivered
+					return nil
 				}
 
 				// Mark the message as processed
@@ -164,4 +175,52 @@ func (c *Consumer) ConsumeClaim(session sarama.ConsumerGroupSession, claim saram
 				return nil
 		}
 	}
-}
\ No newline at end of file
+}
+
+// handleMessage runs the handler of the record's original topic and routes failed
+// records to the retry and dead letter topics, it only fails when ctx is done
+func (c *Consumer) handleMessage(ctx context.Context, msg *sarama.ConsumerMessage) error {
+	originalTopic, attempt := retryState(msg)
+
+	if attempt > 0 {
+		if err := waitForRetry(ctx, msg); err != nil {
+			return err
+		}
+	}
+
+	// Find the handler for the topic
+	handler, exists := c.handlers[originalTopic]
+
+	if !exists {
+		c.logger.Warn("No handler registered for topic", "topic", originalTopic)
+		return nil
+	}
+
+	// Continue the producer's trace while handling the record
+	metadata := Metadata(msg)
+	handlerCtx := tracing.WithTraceParent(ctx, tracing.ChildTraceParent(metadata.TraceParent))
+
+	if metadata.CorrelationID != "" {
+		handlerCtx = tracing.WithCorrelationID(handlerCtx, metadata.CorrelationID)
+	}
+
+	// Handle the message
+	err := handler.HandleMessage(handlerCtx, msg)
+
+	if err == nil {
+		return nil
+	}
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	c.logger.Error("Error handling message",
+		"error", err,
+		"topic", msg.Topic,
+		"partition", msg.Partition,
+		"offset", msg.Offset,
+		"attempt", attempt)
+
+	return c.routeFailure(ctx, msg, originalTopic, attempt, err)
+}
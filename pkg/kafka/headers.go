@@ -0,0 +1,66 @@
+package kafka
+
+import (
+	"github.com/Shopify/sarama"
+)
+
+// Headers describing the event carried by a record, so consumers can route
+// records without deserializing them
+const (
+	HeaderEventType     = "event-type"
+	HeaderEventID       = "event-id"
+	HeaderAggregateType = "aggregate-type"
+	HeaderAggregateID   = "aggregate-id"
+	HeaderCorrelationID = "correlation-id"
+	HeaderSchemaVersion = "schema-version"
+	HeaderTraceParent   = "traceparent" // W3C trace context
+)
+
+// EventMetadata holds the event headers of a record
+type EventMetadata struct {
+	EventType     string
+	EventID       string
+	AggregateType string
+	AggregateID   string
+	CorrelationID string
+	SchemaVersion string
+	TraceParent   string
+}
+
+// Header returns the value of a record header, or an empty string if it is not set
+func Header(msg *sarama.ConsumerMessage, name string) string {
+	for _, header := range msg.Headers {
+		if header != nil && string(header.Key) == name {
+			return string(header.Value)
+		}
+	}
+
+	return ""
+}
+
+// Headers returns all headers of a record
+func Headers(msg *sarama.ConsumerMessage) map[string]string {
+	headers := make(map[string]string, len(msg.Headers))
+
+	for _, header := range msg.Headers {
+		if header != nil {
+			headers[string(header.Key)] = string(header.Value)
+		}
+	}
+
+	return headers
+}
+
+// Metadata returns the event headers of a record, fields are empty for
+// records published without them
+func Metadata(msg *sarama.ConsumerMessage) EventMetadata {
+	return EventMetadata{
+		EventType:     Header(msg, HeaderEventType),
+		EventID:       Header(msg, HeaderEventID),
+		AggregateType: Header(msg, HeaderAggregateType),
+		AggregateID:   Header(msg, HeaderAggregateID),
+		CorrelationID: Header(msg, HeaderCorrelationID),
+		SchemaVersion: Header(msg, HeaderSchemaVersion),
+		TraceParent:   Header(msg, HeaderTraceParent),
+	}
+}
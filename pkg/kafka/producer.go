@@ -2,75 +2,386 @@ package kafka
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sync"
 	"time"
 	"github.com/Shopify/sarama"
+	apperrors "github.com/vaidashi/fault-tolerant-api/pkg/errors"
 	"github.com/vaidashi/fault-tolerant-api/pkg/logger"
 )
 
+// permanentErrors are broker errors that resending the same message won't fix
+var permanentErrors = []error{
+	sarama.ErrMessageSizeTooLarge,
+	sarama.ErrInvalidMessage,
+	sarama.ErrInvalidMessageSize,
+	sarama.ErrInvalidTopic,
+	sarama.ErrTopicAuthorizationFailed,
+	sarama.ErrUnsupportedVersion,
+}
+
 // Producer is a wrapper around the Sarama producer
 type Producer struct {
-	producer sarama.SyncProducer
-	logger   logger.Logger
+	producer      sarama.SyncProducer
+	asyncProducer sarama.AsyncProducer // Set instead of producer in async mode
+	txn           transactionalProducer // Set in transactional mode
+	txMu          sync.Mutex // Kafka allows one open transaction per producer
+	logger        logger.Logger
+	wg            sync.WaitGroup
+}
+
+// transactionalProducer is the transaction API of the sync and async producers
+type transactionalProducer interface {
+	BeginTxn() error
+	CommitTxn() error
+	AbortTxn() error
+}
+
+// ProducerConfig is the configuration for the Kafka producer
+type ProducerConfig struct {
+	Brokers     []string
+	Async       bool          // Batch messages in the background instead of sending them one by one
+	BatchSize   int           // Number of messages that triggers a flush, async mode only
+	BatchBytes  int           // Number of bytes that triggers a flush, async mode only
+	Linger      time.Duration // How long a batch may wait to fill up, async mode only
+	Compression string        // none, gzip, snappy, lz4 or zstd
+	// Idempotent lets the broker drop the duplicates a retry after an ambiguous
+	// timeout would otherwise write
+	Idempotent bool
+	// TransactionalID enables transactions, every send is committed atomically and
+	// SendBatch commits all its messages together. It implies Idempotent and must be
+	// unique per producer instance.
+	TransactionalID string
+}
+
+// Message is a record to publish
+type Message struct {
+	Topic   string
+	Key     string
+	Value   []byte
+	Headers map[string]string
+}
+
+// Delivery is the result of publishing a message
+type Delivery struct {
+	Topic     string
+	Partition int32
+	Offset    int64
+	Err       error
 }
 
 // NewProducer creates a new Kafka producer
-func NewProducer(brokers []string, logger logger.Logger) (*Producer, error) {
+func NewProducer(cfg *ProducerConfig, logger logger.Logger) (*Producer, error) {
+	compression, err := compressionCodec(cfg.Compression)
+
+	if err != nil {
+		return nil, err
+	}
+
 	config := sarama.NewConfig()
 	config.Producer.RequiredAcks = sarama.WaitForAll // Wait for all replicas to acknowledge
 	config.Producer.Retry.Max = 10
 	config.Producer.Return.Successes = true // Return success message confirmations
 	config.Producer.Retry.Backoff = 500 * time.Millisecond
 	config.Producer.Timeout = 5 * time.Second
+	config.Producer.Compression = compression
+
+	if cfg.Idempotent || cfg.TransactionalID != "" {
+		config.Producer.Idempotent = true
+		config.Net.MaxOpenRequests = 1 // Required to keep sequence numbers in order
+		config.Producer.Transaction.ID = cfg.TransactionalID
+	}
+
+	if !cfg.Async {
+		producer, err := sarama.NewSyncProducer(cfg.Brokers, config)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to create Kafka producer: %w", err)
+		}
+
+		p := &Producer{
+			producer: producer,
+			logger:   logger,
+		}
 
-	producer, err := sarama.NewSyncProducer(brokers, config)
+		if cfg.TransactionalID != "" {
+			p.txn = producer
+		}
+
+		return p, nil
+	}
+
+	config.Producer.Return.Errors = true
+	config.Producer.Flush.Messages = cfg.BatchSize
+	config.Producer.Flush.Bytes = cfg.BatchBytes
+	config.Producer.Flush.Frequency = cfg.Linger
+
+	asyncProducer, err := sarama.NewAsyncProducer(cfg.Brokers, config)
 
 	if err != nil {
 		return nil, fmt.Errorf("failed to create Kafka producer: %w", err)
 	}
 
-	return &Producer{
-		producer: producer,
-		logger:   logger,
-	}, nil
+	p := &Producer{
+		asyncProducer: asyncProducer,
+		logger:        logger,
+	}
+
+	if cfg.TransactionalID != "" {
+		p.txn = asyncProducer
+	}
+
+	p.wg.Add(2)
+	go p.forwardSuccesses()
+	go p.forwardErrors()
+
+	logger.Info("Kafka producer running in async mode",
+		"batchSize", cfg.BatchSize,
+		"batchBytes", cfg.BatchBytes,
+		"linger", cfg.Linger,
+		"compression", compression)
+
+	return p, nil
+}
+
+// compressionCodec parses the name of a compression codec
+func compressionCodec(name string) (sarama.CompressionCodec, error) {
+	switch name {
+	case "", "none":
+		return sarama.CompressionNone, nil
+	case "gzip":
+		return sarama.CompressionGZIP, nil
+	case "snappy":
+		return sarama.CompressionSnappy, nil
+	case "lz4":
+		return sarama.CompressionLZ4, nil
+	case "zstd":
+		return sarama.CompressionZSTD, nil
+	default:
+		return sarama.CompressionNone, fmt.Errorf("unknown compression codec %q", name)
+	}
 }
 
 // SendMessage sends a message to the specified topic
 func (p *Producer) SendMessage(ctx context.Context, topic string, key string, value []byte) error {
+	return p.SendMessageWithHeaders(ctx, topic, key, value, nil)
+}
+
+// SendMessageWithHeaders sends a message with record headers to the specified topic
+// and waits for the broker to acknowledge it
+func (p *Producer) SendMessageWithHeaders(ctx context.Context, topic string, key string, value []byte, headers map[string]string) error {
+	select {
+	case delivery := <-p.Publish(ctx, topic, key, value, headers):
+		return delivery.Err
+	case <-ctx.Done():
+		return fmt.Errorf("failed to send message to Kafka: %w", ctx.Err())
+	}
+}
+
+// Publish sends a message with record headers to the specified topic without waiting
+// for the acknowledgement. The returned channel receives the delivery result once the
+// broker acknowledged or rejected the message. In sync and transactional mode the
+// message is sent before Publish returns.
+func (p *Producer) Publish(ctx context.Context, topic string, key string, value []byte, headers map[string]string) <-chan Delivery {
+	msg := newProducerMessage(Message{Topic: topic, Key: key, Value: value, Headers: headers})
+
+	if p.asyncProducer != nil && p.txn == nil {
+		return p.enqueue(ctx, msg)
+	}
+
+	result := make(chan Delivery, 1)
+	var err error
+
+	if p.txn != nil {
+		err = p.sendInTransaction(ctx, []*sarama.ProducerMessage{msg})
+	} else {
+		err = p.sendAll(ctx, []*sarama.ProducerMessage{msg})
+	}
+
+	result <- Delivery{Topic: topic, Partition: msg.Partition, Offset: msg.Offset, Err: err}
+	return result
+}
+
+// SendBatch sends messages and waits for all of them to be acknowledged. In transactional
+// mode they are committed atomically, otherwise some may be written when others fail.
+func (p *Producer) SendBatch(ctx context.Context, messages []Message) error {
+	msgs := make([]*sarama.ProducerMessage, len(messages))
+
+	for i, message := range messages {
+		msgs[i] = newProducerMessage(message)
+	}
+
+	if p.txn != nil {
+		return p.sendInTransaction(ctx, msgs)
+	}
+
+	return p.sendAll(ctx, msgs)
+}
+
+// newProducerMessage converts a message to a sarama message
+func newProducerMessage(message Message) *sarama.ProducerMessage {
 	msg := &sarama.ProducerMessage{
-		Topic: topic,
-		Value: sarama.ByteEncoder(value),
+		Topic: message.Topic,
+		Value: sarama.ByteEncoder(message.Value),
 	}
 
-	if key != "" {
-		msg.Key = sarama.StringEncoder(key)
+	if message.Key != "" {
+		msg.Key = sarama.StringEncoder(message.Key)
 	}
 
-	// Add a deadline to the context if given
-	if deadline, ok := ctx.Deadline(); ok {
-		msg.Metadata = deadline
+	for name, value := range message.Headers {
+		msg.Headers = append(msg.Headers, sarama.RecordHeader{
+			Key:   []byte(name),
+			Value: []byte(value),
+		})
 	}
 
-	partition, offset, err := p.producer.SendMessage(msg)
+	return msg
+}
 
-	if err != nil {
-		p.logger.Error("Failed to send message to Kafka",
-			"error", err,
-			"topic", topic,
-			"key", key)
-		return fmt.Errorf("failed to send message to Kafka: %w", err)
+// enqueue hands a message to the async producer, the result is reported
+// by forwardSuccesses or forwardErrors
+func (p *Producer) enqueue(ctx context.Context, msg *sarama.ProducerMessage) <-chan Delivery {
+	result := make(chan Delivery, 1)
+	msg.Metadata = result
+
+	select {
+	case p.asyncProducer.Input() <- msg:
+	case <-ctx.Done():
+		result <- Delivery{Topic: msg.Topic, Err: fmt.Errorf("failed to send message to Kafka: %w", ctx.Err())}
 	}
 
-	p.logger.Debug("Message sent to Kafka",
-		"topic", topic,
-		"key", key,
-		"partition", partition,
-		"offset", offset)
+	return result
+}
+
+// sendAll sends messages and waits until all of them are acknowledged or rejected
+func (p *Producer) sendAll(ctx context.Context, msgs []*sarama.ProducerMessage) error {
+	if p.asyncProducer == nil {
+		if err := p.producer.SendMessages(msgs); err != nil {
+			p.logger.Error("Failed to send messages to Kafka", "error", err, "count", len(msgs))
+
+			// Classify by the first rejected message
+			var producerErrs sarama.ProducerErrors
+
+			if errors.As(err, &producerErrs) && len(producerErrs) > 0 {
+				return classifySendError(producerErrs[0].Err)
+			}
+			return classifySendError(err)
+		}
+
+		for _, msg := range msgs {
+			p.logger.Debug("Message sent to Kafka",
+				"topic", msg.Topic,
+				"partition", msg.Partition,
+				"offset", msg.Offset)
+		}
+
+		return nil
+	}
+
+	results := make([]<-chan Delivery, len(msgs))
+
+	for i, msg := range msgs {
+		results[i] = p.enqueue(ctx, msg)
+	}
+
+	// Every enqueued message is reported, even when the producer is closed
+	var firstErr error
+
+	for _, result := range results {
+		if delivery := <-result; delivery.Err != nil && firstErr == nil {
+			firstErr = delivery.Err
+		}
+	}
+
+	return firstErr
+}
+
+// sendInTransaction sends messages in a single Kafka transaction, aborting it
+// if any of them is rejected
+func (p *Producer) sendInTransaction(ctx context.Context, msgs []*sarama.ProducerMessage) error {
+	p.txMu.Lock()
+	defer p.txMu.Unlock()
+
+	if err := p.txn.BeginTxn(); err != nil {
+		p.logger.Error("Failed to begin Kafka transaction", "error", err)
+		return fmt.Errorf("failed to begin Kafka transaction: %w", err)
+	}
+
+	if err := p.sendAll(ctx, msgs); err != nil {
+		p.abortTransaction()
+		return err
+	}
+
+	if err := p.txn.CommitTxn(); err != nil {
+		p.logger.Error("Failed to commit Kafka transaction", "error", err, "count", len(msgs))
+		p.abortTransaction()
+		return fmt.Errorf("failed to commit Kafka transaction: %w", err)
+	}
 
 	return nil
 }
 
-// Close closes the producer
+// abortTransaction aborts the open transaction so its messages are never read
+// by consumers using the read committed isolation level
+func (p *Producer) abortTransaction() {
+	if err := p.txn.AbortTxn(); err != nil {
+		p.logger.Error("Failed to abort Kafka transaction", "error", err)
+	}
+}
+
+// forwardSuccesses reports acknowledged messages to their publishers
+func (p *Producer) forwardSuccesses() {
+	defer p.wg.Done()
+
+	for msg := range p.asyncProducer.Successes() {
+		p.logger.Debug("Message sent to Kafka",
+			"topic", msg.Topic,
+			"partition", msg.Partition,
+			"offset", msg.Offset)
+
+		if result, ok := msg.Metadata.(chan Delivery); ok {
+			result <- Delivery{Topic: msg.Topic, Partition: msg.Partition, Offset: msg.Offset}
+		}
+	}
+}
+
+// forwardErrors reports rejected messages to their publishers
+func (p *Producer) forwardErrors() {
+	defer p.wg.Done()
+
+	for producerErr := range p.asyncProducer.Errors() {
+		msg := producerErr.Msg
+
+		p.logger.Error("Failed to send message to Kafka",
+			"error", producerErr.Err,
+			"topic", msg.Topic)
+
+		if result, ok := msg.Metadata.(chan Delivery); ok {
+			result <- Delivery{Topic: msg.Topic, Partition: msg.Partition, Err: classifySendError(producerErr.Err)}
+		}
+	}
+}
+
+// classifySendError marks errors that can't be fixed by resending as permanent failures
+func classifySendError(err error) error {
+	for _, permanentErr := range permanentErrors {
+		if errors.Is(err, permanentErr) {
+			return fmt.Errorf("%w: failed to send message to Kafka: %v", apperrors.ErrPermanentFailure, err)
+		}
+	}
+
+	return fmt.Errorf("failed to send message to Kafka: %w", err)
+}
+
+// Close closes the producer, in async mode buffered messages are flushed first
 func (p *Producer) Close() error {
+	if p.asyncProducer != nil {
+		err := p.asyncProducer.Close()
+		p.wg.Wait()
+		return err
+	}
+
 	return p.producer.Close()
 }
\ No newline at end of file
@@ -0,0 +1,193 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Shopify/sarama"
+	apperrors "github.com/vaidashi/fault-tolerant-api/pkg/errors"
+	"github.com/vaidashi/fault-tolerant-api/pkg/retry"
+)
+
+// Headers added to records republished to retry and dead letter topics
+const (
+	HeaderOriginalTopic     = "x-original-topic"
+	HeaderOriginalPartition = "x-original-partition"
+	HeaderOriginalOffset    = "x-original-offset"
+	HeaderRetryAttempt      = "x-retry-attempt"
+	HeaderRetryNotBefore    = "x-retry-not-before" // RFC3339 time before which the record must not be retried
+	HeaderError             = "x-error"
+	HeaderFailedAt          = "x-failed-at"
+)
+
+// maxErrorHeaderLength bounds the error header so a long error can't make the record too large
+const maxErrorHeaderLength = 1024
+
+// RetryTopic returns the name of the retry topic for the given attempt, starting at 1
+func RetryTopic(topic string, attempt int) string {
+	return fmt.Sprintf("%s.retry.%d", topic, attempt)
+}
+
+// DeadLetterTopic returns the name of the dead letter topic of a topic
+func DeadLetterTopic(topic string) string {
+	return topic + ".dlt"
+}
+
+// retryState returns the topic a record was originally consumed from and
+// how many times it has been retried
+func retryState(msg *sarama.ConsumerMessage) (string, int) {
+	originalTopic := Header(msg, HeaderOriginalTopic)
+
+	if originalTopic == "" {
+		return msg.Topic, 0
+	}
+
+	attempt, err := strconv.Atoi(Header(msg, HeaderRetryAttempt))
+
+	if err != nil {
+		attempt = 0
+	}
+
+	return originalTopic, attempt
+}
+
+// waitForRetry blocks until a record read from a retry topic is due
+func waitForRetry(ctx context.Context, msg *sarama.ConsumerMessage) error {
+	notBefore, err := time.Parse(time.RFC3339Nano, Header(msg, HeaderRetryNotBefore))
+
+	if err != nil {
+		return nil
+	}
+
+	delay := time.Until(notBefore)
+
+	if delay <= 0 {
+		return nil
+	}
+
+	// Records in a retry topic share the same delay, so the ones behind
+	// this record are not due yet either
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// routeFailure republishes a record that failed to be handled to the next retry
+// topic, or to the dead letter topic once the retries are used up or the error is permanent
+func (c *Consumer) routeFailure(ctx context.Context, msg *sarama.ConsumerMessage, originalTopic string, attempt int, handlerErr error) error {
+	// Carry over the producer's headers
+	headers := Headers(msg)
+
+	// Keep the position of the first delivery across retries
+	if attempt == 0 {
+		headers[HeaderOriginalTopic] = msg.Topic
+		headers[HeaderOriginalPartition] = strconv.FormatInt(int64(msg.Partition), 10)
+		headers[HeaderOriginalOffset] = strconv.FormatInt(msg.Offset, 10)
+	}
+
+	now := time.Now().UTC()
+	headers[HeaderError] = truncateHeader(handlerErr.Error(), maxErrorHeaderLength)
+	headers[HeaderFailedAt] = now.Format(time.RFC3339Nano)
+
+	deadLetterTopic := DeadLetterTopic(originalTopic)
+	target := deadLetterTopic
+
+	if !apperrors.IsPermanent(handlerErr) && attempt < len(c.retryDelays) {
+		target = RetryTopic(originalTopic, attempt+1)
+		headers[HeaderRetryAttempt] = strconv.Itoa(attempt + 1)
+		headers[HeaderRetryNotBefore] = now.Add(c.retryDelays[attempt]).Format(time.RFC3339Nano)
+	} else {
+		delete(headers, HeaderRetryNotBefore)
+	}
+
+	// The record must not be lost, so keep trying until the session ends unless
+	// resending can never succeed
+	backoff := retry.NewDefaultExponentialBackoff()
+
+	for publishAttempt := 1; ; publishAttempt++ {
+		err := c.producer.SendMessageWithHeaders(ctx, target, string(msg.Key), msg.Value, headers)
+
+		if err == nil {
+			c.logger.Warn("Failed record republished",
+				"error", handlerErr,
+				"topic", target,
+				"originalTopic", originalTopic,
+				"originalOffset", headers[HeaderOriginalOffset],
+				"attempt", attempt)
+			return nil
+		}
+
+		c.logger.Error("Failed to republish record",
+			"error", err,
+			"topic", target,
+			"partition", msg.Partition,
+			"offset", msg.Offset)
+
+		// Fall back to the dead letter topic, and log the record as a last resort
+		// rather than block its partition for good
+		if !canRepublish(err) {
+			if target != deadLetterTopic {
+				target = deadLetterTopic
+				delete(headers, HeaderRetryNotBefore)
+
+				if attempt > 0 {
+					headers[HeaderRetryAttempt] = strconv.Itoa(attempt)
+				} else {
+					delete(headers, HeaderRetryAttempt)
+				}
+
+				publishAttempt = 0
+				continue
+			}
+
+			c.logger.Error("Dropping record that can't be republished",
+				"error", handlerErr,
+				"publishError", err,
+				"topic", msg.Topic,
+				"partition", msg.Partition,
+				"offset", msg.Offset,
+				"key", string(msg.Key),
+				"originalTopic", originalTopic,
+				"originalOffset", headers[HeaderOriginalOffset],
+				"attempt", attempt)
+			return nil
+		}
+
+		select {
+		case <-time.After(backoff.NextBackoff(publishAttempt)):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// canRepublish reports whether sending a record again may succeed, records that are
+// rejected outright or target a topic that doesn't exist never will
+func canRepublish(err error) bool {
+	return !apperrors.IsPermanent(err) && !errors.Is(err, sarama.ErrUnknownTopicOrPartition)
+}
+
+// truncateHeader shortens a header value to at most max bytes without splitting a character
+func truncateHeader(value string, max int) string {
+	if len(value) <= max {
+		return value
+	}
+
+	value = value[:max]
+
+	for len(value) > 0 && !utf8.ValidString(value) {
+		value = value[:len(value)-1]
+	}
+
+	return value
+}
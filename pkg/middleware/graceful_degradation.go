@@ -15,13 +15,34 @@ type GracefulDegradation struct {
 	logger logger.Logger
 }
 
-// NewGracefulDegradation creates a new graceful degradation middleware
-func NewGracefulDegradation(logger logger.Logger) *GracefulDegradation {
-	breaker := circuitbreaker.NewCircuitBreaker(circuitbreaker.CircuitBreakerConfig{
+// InboundBreakerName is the registry name of the breaker guarding inbound HTTP traffic
+const InboundBreakerName = "http-inbound"
+
+// NewGracefulDegradation creates a new graceful degradation middleware whose breaker
+// trips on consecutive failures, or on the failure and slow-call rates over the last
+// minute when mode is ModeSlidingWindow
+func NewGracefulDegradation(registry *circuitbreaker.Registry, mode circuitbreaker.Mode, logger logger.Logger) *GracefulDegradation {
+	config := circuitbreaker.CircuitBreakerConfig{
 		FailureThreshold: 10,             // Open circuit after 10 failures
 		ResetTimeout:     30 * time.Second, // Wait 30 seconds before trying again
 		HalfOpenMaxCalls: 5,              // Allow 5 requests in half-open state
-	})
+	}
+
+	if mode == circuitbreaker.ModeSlidingWindow {
+		config = circuitbreaker.CircuitBreakerConfig{
+			Mode:                      circuitbreaker.ModeSlidingWindow,
+			WindowType:                circuitbreaker.WindowTypeTime,
+			WindowDuration:            60 * time.Second, // Evaluate the last 60 seconds of requests
+			MinimumRequests:           20,               // Need at least 20 requests before tripping
+			FailureRateThreshold:      50,               // Open circuit when 50% of requests fail
+			SlowCallDurationThreshold: 5 * time.Second,  // Requests slower than 5 seconds are slow
+			SlowCallRateThreshold:     80,               // Open circuit when 80% of requests are slow
+			ResetTimeout:              30 * time.Second, // Wait 30 seconds before trying again
+			HalfOpenMaxCalls:          5,                // Allow 5 requests in half-open state
+		}
+	}
+
+	breaker := registry.Register(InboundBreakerName, config)
 	
 	return &GracefulDegradation{
 		breaker: breaker,
@@ -49,6 +70,7 @@ func (gd *GracefulDegradation) Middleware(next http.Handler) http.Handler {
 
 		// Use a custom response writer to track status codes
 		wrappedWriter := newStatusCodeWriter(w)
+		start := time.Now()
 		
 		// Process the request
 		next.ServeHTTP(wrappedWriter, r)
@@ -56,10 +78,14 @@ func (gd *GracefulDegradation) Middleware(next http.Handler) http.Handler {
 		// Update circuit breaker based on response
 		if !isEssential {
 			statusCode := wrappedWriter.statusCode
+			duration := time.Since(start)
 			if statusCode >= 500 {
-				gd.breaker.Failure()
+				gd.breaker.RecordResult(false, duration)
 			} else if statusCode < 400 {
-				gd.breaker.Success()
+				gd.breaker.RecordResult(true, duration)
+			} else {
+				// Client errors say nothing about our health, but must free a half-open slot
+				gd.breaker.Release()
 			}
 		}
 	}))
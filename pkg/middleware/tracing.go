@@ -0,0 +1,29 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/vaidashi/fault-tolerant-api/pkg/tracing"
+)
+
+// TracingMiddleware attaches a correlation ID and a trace context to every request,
+// continuing the ones sent by the client, and echoes them in the response
+func TracingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		correlationID := r.Header.Get(tracing.CorrelationIDHeader)
+
+		if correlationID == "" || len(correlationID) > 100 {
+			correlationID = tracing.NewCorrelationID()
+		}
+
+		traceParent := tracing.ChildTraceParent(r.Header.Get(tracing.TraceParentHeader))
+
+		ctx := tracing.WithCorrelationID(r.Context(), correlationID)
+		ctx = tracing.WithTraceParent(ctx, traceParent)
+
+		w.Header().Set(tracing.CorrelationIDHeader, correlationID)
+		w.Header().Set(tracing.TraceParentHeader, traceParent)
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
@@ -6,18 +6,28 @@ import (
 	"errors"
 	"fmt"
 
+	apperrors "github.com/vaidashi/fault-tolerant-api/pkg/errors"
 	"github.com/vaidashi/fault-tolerant-api/pkg/logger"
 )
 
 // RetryableFunc defines a function that can be retried
 type RetryableFunc func() error
 
+// ErrorClassifier reports whether an error is worth retrying
+type ErrorClassifier func(err error) bool
+
 // RetryConfig holds the configuration for retrying operations
 type RetryConfig struct {
 	MaxAttempts int           
 	BackoffStrategy BackoffStrategy
 	Logger logger.Logger 
 	RetryableErrors []error // List of errors to retry on
+	Classifier ErrorClassifier // Decides which errors to retry on, takes precedence over RetryableErrors
+}
+
+// RetryUnlessPermanent retries every error except those pkg/errors classifies as permanent
+func RetryUnlessPermanent(err error) bool {
+	return !apperrors.IsPermanent(err)
 }
 
 // Retry retries the given function according to the provided configuration
@@ -49,7 +59,7 @@ func Retry(ctx context.Context, fn RetryableFunc, cfg *RetryConfig) error {
 		}
 
 		// Check if error is retryable
-		if !isRetryable(err, cfg.RetryableErrors) {
+		if !cfg.isRetryable(err) {
 			cfg.Logger.Warn("Non-retryable error encountered, giving up",
 				"error", err,
 				"attempt", attempt)
@@ -78,14 +88,18 @@ func Retry(ctx context.Context, fn RetryableFunc, cfg *RetryConfig) error {
 }
 
 // isRetryable checks if an error is retryable
-func isRetryable(err error, retryableErrors []error) bool {
+func (cfg *RetryConfig) isRetryable(err error) bool {
+	if cfg.Classifier != nil {
+		return cfg.Classifier(err)
+	}
+
 	// If no specific errors are defined, assume all errors are retryable
-	if len(retryableErrors) == 0 {
+	if len(cfg.RetryableErrors) == 0 {
 		return true
 	}
 
 	// Check if the error is in the list of retryable errors
-	for _, retryableErr := range retryableErrors {
+	for _, retryableErr := range cfg.RetryableErrors {
 		if errors.Is(err, retryableErr) {
 			return true
 		}
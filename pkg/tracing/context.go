@@ -0,0 +1,110 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// HTTP headers carrying the correlation ID and the W3C trace context
+const (
+	CorrelationIDHeader = "X-Correlation-ID"
+	TraceParentHeader   = "traceparent"
+)
+
+type contextKey int
+
+const (
+	correlationIDKey contextKey = iota
+	traceParentKey
+)
+
+// WithCorrelationID returns a copy of ctx carrying the correlation ID
+func WithCorrelationID(ctx context.Context, correlationID string) context.Context {
+	return context.WithValue(ctx, correlationIDKey, correlationID)
+}
+
+// CorrelationID returns the correlation ID carried by ctx, or an empty string
+func CorrelationID(ctx context.Context) string {
+	correlationID, _ := ctx.Value(correlationIDKey).(string)
+	return correlationID
+}
+
+// NewCorrelationID generates a new correlation ID
+func NewCorrelationID() string {
+	return uuid.New().String()
+}
+
+// WithTraceParent returns a copy of ctx carrying the W3C traceparent
+func WithTraceParent(ctx context.Context, traceParent string) context.Context {
+	return context.WithValue(ctx, traceParentKey, traceParent)
+}
+
+// TraceParent returns the W3C traceparent carried by ctx, or an empty string
+func TraceParent(ctx context.Context) string {
+	traceParent, _ := ctx.Value(traceParentKey).(string)
+	return traceParent
+}
+
+// NewTraceParent starts a new sampled trace
+func NewTraceParent() string {
+	return "00-" + randomHex(16) + "-" + randomHex(8) + "-01"
+}
+
+// ChildTraceParent continues the trace of parent in a new span, starting
+// a new trace if parent is not a valid traceparent
+func ChildTraceParent(parent string) string {
+	if !ValidTraceParent(parent) {
+		return NewTraceParent()
+	}
+
+	parts := strings.Split(parent, "-")
+	return parts[0] + "-" + parts[1] + "-" + randomHex(8) + "-" + parts[3]
+}
+
+// ValidTraceParent checks that s is a version 00 W3C traceparent
+func ValidTraceParent(s string) bool {
+	parts := strings.Split(s, "-")
+
+	if len(parts) != 4 || parts[0] != "00" {
+		return false
+	}
+
+	if !isHex(parts[1], 32) || !isHex(parts[2], 16) || !isHex(parts[3], 2) {
+		return false
+	}
+
+	// All zero trace and span IDs are invalid
+	return parts[1] != strings.Repeat("0", 32) && parts[2] != strings.Repeat("0", 16)
+}
+
+// isHex checks that s is a lowercase hex string of the given length
+func isHex(s string, length int) bool {
+	if len(s) != length {
+		return false
+	}
+
+	for _, c := range s {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+			return false
+		}
+	}
+
+	return true
+}
+
+// randomHex returns n random bytes encoded as hex
+func randomHex(n int) string {
+	b := make([]byte, n)
+
+	if _, err := rand.Read(b); err != nil {
+		// Fall back to a UUID, which is random too
+		id := uuid.New()
+		copy(b, id[:])
+	}
+
+	return hex.EncodeToString(b)
+}
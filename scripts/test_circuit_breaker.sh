@@ -11,7 +11,7 @@ ORDER_IDS=()
 for i in $(seq 1 5); do
     RESPONSE=$(curl -s -X POST "$URL" \
         -H "Content-Type: application/json" \
-        -d "{\"customer_id\":\"cust-circuit-$i\", \"amount\":99.99, \"description\":\"Circuit breaker test $i\"}")
+        -d "{\"customer_id\":\"cust-circuit-$i\", \"items\":[{\"product_id\":\"prod-001\",\"quantity\":1,\"unit_price\":99.99}], \"shipping_address\":{\"recipient\":\"Jane Doe\",\"line1\":\"123 Main St\",\"city\":\"Anytown\",\"state\":\"CA\",\"postal_code\":\"90210\",\"country\":\"US\"}, \"description\":\"Circuit breaker test $i\"}")
     
     ORDER_ID=$(echo $RESPONSE | jq -r '.data.id')
     if [ "$ORDER_ID" != "null" ]; then
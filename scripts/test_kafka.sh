@@ -4,7 +4,7 @@
 echo "Creating new order to test Kafka integration..."
 CREATE_RESPONSE=$(curl -s -X POST http://localhost:8080/api/v1/orders \
   -H "Content-Type: application/json" \
-  -d '{"customer_id":"cust-001", "amount":199.99, "description":"Testing Kafka integration"}')
+  -d '{"customer_id":"cust-001", "items":[{"product_id":"prod-001","quantity":1,"unit_price":199.99}], "shipping_address":{"recipient":"Jane Doe","line1":"123 Main St","city":"Anytown","state":"CA","postal_code":"90210","country":"US"}, "description":"Testing Kafka integration"}')
 
 ORDER_ID=$(echo $CREATE_RESPONSE | jq -r '.data.id')
 echo "Created order with ID: $ORDER_ID"
@@ -23,7 +23,7 @@ sleep 2
 echo "Updating order details..."
 curl -s -X PUT http://localhost:8080/api/v1/orders/$ORDER_ID \
   -H "Content-Type: application/json" \
-  -d '{"amount":249.99, "description":"Updated Kafka test"}'
+  -d '{"description":"Updated Kafka test"}'
 
 echo "Waiting for Kafka processing..."
 sleep 2
@@ -6,7 +6,7 @@
 echo "Creating an order to generate a message..."
 CREATE_RESPONSE=$(curl -s -X POST http://localhost:8080/api/v1/orders \
   -H "Content-Type: application/json" \
-  -d '{"customer_id":"cust-retry", "amount":299.99, "description":"Testing retry mechanism"}')
+  -d '{"customer_id":"cust-retry", "items":[{"product_id":"prod-001","quantity":1,"unit_price":299.99}], "shipping_address":{"recipient":"Jane Doe","line1":"123 Main St","city":"Anytown","state":"CA","postal_code":"90210","country":"US"}, "description":"Testing retry mechanism"}')
 
 ORDER_ID=$(echo $CREATE_RESPONSE | jq -r '.data.id')
 echo "Created order with ID: $ORDER_ID"
@@ -6,7 +6,7 @@
 echo "Creating an order..."
 CREATE_RESPONSE=$(curl -s -X POST http://localhost:8080/api/v1/orders \
   -H "Content-Type: application/json" \
-  -d '{"customer_id":"cust-warehouse", "amount":399.99, "description":"Testing warehouse integration"}')
+  -d '{"customer_id":"cust-warehouse", "items":[{"product_id":"prod-001","quantity":1,"unit_price":399.99}], "shipping_address":{"recipient":"Jane Doe","line1":"123 Main St","city":"Anytown","state":"CA","postal_code":"90210","country":"US"}, "description":"Testing warehouse integration"}')
 
 ORDER_ID=$(echo $CREATE_RESPONSE | jq -r '.data.id')
 echo "Created order with ID: $ORDER_ID"